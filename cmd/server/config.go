@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 func NewConfig() Config {
 	return Config{
 		Server:   ServerConfig{},
@@ -22,11 +24,18 @@ type ServerConfig struct {
 
 	BackendTokens  []string `env:"SERVER_BACKEND_TOKENS" envDefault:"fcbae6821cb21dd6e2aba928e281e7da"`
 	FrontendTokens []string `env:"SERVER_FRONTEND_TOKENS" envDefault:"0f461a1c7ef387b82694d3014725081c"`
+
+	BotRegistryRefreshInterval time.Duration `env:"SERVER_BOT_REGISTRY_REFRESH_INTERVAL" envDefault:"1m"`
 }
 
 type DepotConfig struct {
 	Host  string `env:"DEPOT_HOST" envDefault:"https://depot.drapps.lol"`
 	Token string `env:"DEPOT_TOKEN" envDefault:"fcbae6821cb21dd6e2aba928e281e7da"`
+
+	CacheTTL         time.Duration `env:"DEPOT_CACHE_TTL" envDefault:"1m"`
+	BreakerThreshold int           `env:"DEPOT_BREAKER_THRESHOLD" envDefault:"5"`
+	BreakerCooldown  time.Duration `env:"DEPOT_BREAKER_COOLDOWN" envDefault:"30s"`
+	RefillInterval   time.Duration `env:"DEPOT_REFILL_INTERVAL" envDefault:"1m"`
 }
 
 type LoggerConfig struct {
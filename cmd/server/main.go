@@ -70,6 +70,13 @@ func main() {
 		FrontendTokens: convertTokens(cfg.Server.FrontendTokens),
 
 		ExposeMetrics: cfg.Server.ExposeMetrics,
+
+		DepotCacheTTL:         cfg.Depot.CacheTTL,
+		DepotBreakerThreshold: cfg.Depot.BreakerThreshold,
+		DepotBreakerCooldown:  cfg.Depot.BreakerCooldown,
+		DepotRefillInterval:   cfg.Depot.RefillInterval,
+
+		BotRegistryRefreshInterval: cfg.Server.BotRegistryRefreshInterval,
 	}, &server.Deps{
 		PG:    pg,
 		GeoIP: geoIP,
@@ -3,24 +3,41 @@ package main
 import "time"
 
 const (
-	WorkerFBToolFetcher  = "fbtool-fetcher"
-	WorkerOnlineSnapshot = "online-snapshot"
+	WorkerFBToolFetcher       = "fbtool-fetcher"
+	WorkerOnlineSnapshot      = "online-snapshot"
+	WorkerMailingLeaseExpirer = "mailing-lease-expirer"
+	WorkerExpensesFetcher     = "expenses-fetcher"
+	WorkerRetention           = "retention"
+	WorkerDepotSync           = "depot-sync"
+)
+
+const (
+	// dead channel users are left in place, moved to the primary channel or spread over all active channels
+	DepotSyncPolicyNone    = "none"
+	DepotSyncPolicyPrimary = "primary"
+	DepotSyncPolicySpread  = "spread"
 )
 
 func NewConfig() Config {
 	return Config{
-		Worker:   WorkerConfig{},
-		Logger:   LoggerConfig{},
-		Depot:    DepotConfig{},
-		Postgres: PostgresConfig{},
+		Worker:    WorkerConfig{},
+		Logger:    LoggerConfig{},
+		Depot:     DepotConfig{},
+		Postgres:  PostgresConfig{},
+		Expenses:  ExpensesConfig{},
+		Retention: RetentionConfig{},
+		DepotSync: DepotSyncConfig{},
 	}
 }
 
 type Config struct {
-	Worker   WorkerConfig
-	Logger   LoggerConfig
-	Depot    DepotConfig
-	Postgres PostgresConfig
+	Worker    WorkerConfig
+	Logger    LoggerConfig
+	Depot     DepotConfig
+	Postgres  PostgresConfig
+	Expenses  ExpensesConfig
+	Retention RetentionConfig
+	DepotSync DepotSyncConfig
 }
 
 type WorkerConfig struct {
@@ -48,3 +65,29 @@ type PostgresConfig struct {
 	Password string `env:"POSTGRES_PASSWORD" envDefault:"pass"`
 	Port     string `env:"POSTGRES_PORT" envDefault:"5432"`
 }
+
+type ExpensesConfig struct {
+	// CSVURLs are name=url pairs, the name is stored as the expense source
+	CSVURLs []string `env:"EXPENSES_CSV_URLS" envSeparator:","`
+}
+
+// RetentionConfig periods are counted back from now, zero keeps the table intact.
+type RetentionConfig struct {
+	PricesHourlyAfter    time.Duration `env:"RETENTION_PRICES_HOURLY_AFTER" envDefault:"720h"`
+	SnapshotsHourlyAfter time.Duration `env:"RETENTION_SNAPSHOTS_HOURLY_AFTER" envDefault:"720h"`
+
+	FBToolStatsTTL time.Duration `env:"RETENTION_FBTOOL_STATS_TTL" envDefault:"0"`
+	// EventsLogTTL also truncates the person timeline and the events of the user profile,
+	// both are read from events_log
+	EventsLogTTL         time.Duration `env:"RETENTION_EVENTS_LOG_TTL" envDefault:"0"`
+	MailingDeliveriesTTL time.Duration `env:"RETENTION_MAILING_DELIVERIES_TTL" envDefault:"0"`
+}
+
+type DepotSyncConfig struct {
+	// Policy defaults to none so dead channels are only reported until the reassignment is opted in,
+	// depot reports every channel but the current one of the bot as rotated
+	Policy string `env:"DEPOT_SYNC_POLICY" envDefault:"none"`
+
+	// ChannelsFile replaces depot with a json file of bot token to channels with their states
+	ChannelsFile string `env:"DEPOT_SYNC_CHANNELS_FILE" envDefault:""`
+}
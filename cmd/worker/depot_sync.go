@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prosperofair/pkg/depot"
+	"github.com/prosperofair/pkg/log"
+	"go.uber.org/zap"
+
+	"github.com/prosperofair/stata/cmd/worker/depotsync"
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// depotSync reconciles the channels of every active bot users with the channels of the source.
+// Users of channels with a changed telegram channel follow the change, users of channels the source
+// reports banned or rotated, or doesn't list when it is exhaustive, are reassigned by the policy, every move is recorded as a sync channel migration.
+func (w *Worker) depotSync() error {
+	source := w.channelSource()
+
+	bots, err := w.pg.SelectAllBots()
+	if err != nil {
+		return fmt.Errorf("failed to select bots: %w", err)
+	}
+
+	for _, bot := range bots {
+		if !bot.Active {
+			continue
+		}
+
+		if err := w.syncBotChannels(w.pg, source, bot); err != nil {
+			log.Error("failed to sync bot channels",
+				zap.String("source", source.Name()), zap.Int("bot_id", bot.ID), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+func (w *Worker) channelSource() depotsync.Source {
+	if w.cfg.DepotSync.ChannelsFile != "" {
+		return depotsync.NewFileSource(w.cfg.DepotSync.ChannelsFile)
+	}
+
+	return depotsync.NewDepotSource(depot.NewClient(&depot.Config{
+		Host:  w.cfg.Depot.Host,
+		Token: w.cfg.Depot.Token,
+	}))
+}
+
+// depotSyncStore is the part of the postgres client the sync reads the users channels from and migrates them with.
+type depotSyncStore interface {
+	SelectBotUsersChannels(botID int) ([]*types.UserChannelUsage, error)
+	MigrateUsersChannel(migration *types.ChannelMigration, dryRun bool) error
+}
+
+func (w *Worker) syncBotChannels(store depotSyncStore, source depotsync.Source, bot *types.Bot) error {
+	known, err := source.Channels(bot)
+	if err != nil {
+		return err
+	}
+
+	// without active channels there is nowhere to move the users
+	active := known.Active
+	if len(active) == 0 {
+		return nil
+	}
+
+	channels := make(map[string]*types.UserChannel, len(active))
+	for _, channel := range active {
+		channels[channel.DepotChannelHash] = channel
+	}
+
+	used, err := store.SelectBotUsersChannels(bot.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, usage := range used {
+		channel, ok := channels[usage.DepotChannelHash]
+		if ok {
+			if channel.TelegramChannelID == usage.TelegramChannelID && channel.TelegramChannelURL == usage.TelegramChannelURL {
+				continue
+			}
+
+			if err := w.syncMigrate(store, bot, usage, []*types.UserChannel{channel}); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// a channel the source doesn't know may still be alive, only dead channels move users
+		state, ok := known.State(usage.DepotChannelHash)
+		if !ok {
+			log.Info("skipped channel in unknown state",
+				zap.Int("bot_id", bot.ID),
+				zap.String("depot_channel_hash", usage.DepotChannelHash),
+				zap.Int("users", usage.Users),
+			)
+			continue
+		}
+
+		switch w.cfg.DepotSync.Policy {
+		case DepotSyncPolicyPrimary:
+			err = w.syncMigrate(store, bot, usage, active[:1])
+		case DepotSyncPolicySpread:
+			err = w.syncMigrate(store, bot, usage, active)
+		default:
+			log.Info("found dead channel",
+				zap.Int("bot_id", bot.ID),
+				zap.String("depot_channel_hash", usage.DepotChannelHash),
+				zap.String("state", state),
+				zap.Int("users", usage.Users),
+			)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncMigrate spreads the channel users evenly over the targets.
+func (w *Worker) syncMigrate(store depotSyncStore, bot *types.Bot, usage *types.UserChannelUsage, targets []*types.UserChannel) error {
+	for i, target := range targets {
+		migration := &types.ChannelMigration{
+			BotID:                bot.ID,
+			FromDepotChannelHash: usage.DepotChannelHash,
+			ToDepotChannelHash:   target.DepotChannelHash,
+			ToTelegramChannelID:  target.TelegramChannelID,
+			ToTelegramChannelURL: target.TelegramChannelURL,
+			Percent:              100 / float64(len(targets)-i),
+			Reason:               types.ChannelMigrationReasonSync,
+		}
+
+		if err := store.MigrateUsersChannel(migration, w.cfg.Worker.DryRun); err != nil {
+			return fmt.Errorf("failed to migrate channel users: %w", err)
+		}
+
+		log.Info("synced channel users",
+			zap.Int("bot_id", bot.ID),
+			zap.String("from_depot_channel_hash", migration.FromDepotChannelHash),
+			zap.String("to_depot_channel_hash", migration.ToDepotChannelHash),
+			zap.Int("users", migration.Users),
+			zap.Bool("dry_run", w.cfg.Worker.DryRun),
+		)
+	}
+
+	return nil
+}
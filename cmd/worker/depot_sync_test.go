@@ -0,0 +1,134 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prosperofair/stata/cmd/worker/depotsync"
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+type depotSyncStoreMock struct {
+	used       []*types.UserChannelUsage
+	migrations []*types.ChannelMigration
+}
+
+func (m *depotSyncStoreMock) SelectBotUsersChannels(int) ([]*types.UserChannelUsage, error) {
+	return m.used, nil
+}
+
+func (m *depotSyncStoreMock) MigrateUsersChannel(migration *types.ChannelMigration, _ bool) error {
+	m.migrations = append(m.migrations, migration)
+	return nil
+}
+
+type sourceMock struct {
+	channels *depotsync.Channels
+}
+
+func (s *sourceMock) Name() string {
+	return "mock"
+}
+
+func (s *sourceMock) Channels(*types.Bot) (*depotsync.Channels, error) {
+	return s.channels, nil
+}
+
+func TestSyncBotChannelsPolicies(t *testing.T) {
+	active := []*types.UserChannel{
+		{DepotChannelHash: "primary", TelegramChannelID: 1, TelegramChannelURL: "https://t.me/primary"},
+		{DepotChannelHash: "second", TelegramChannelID: 2, TelegramChannelURL: "https://t.me/second"},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		policy   string
+		channels *depotsync.Channels
+		want     map[string]float64
+	}{
+		{
+			name:     "primary moves banned channel users to the first active channel",
+			policy:   DepotSyncPolicyPrimary,
+			channels: &depotsync.Channels{Active: active, Dead: map[string]string{"old": depotsync.ChannelStateBanned}},
+			want:     map[string]float64{"primary": 100},
+		},
+		{
+			name:     "spread splits rotated channel users between active channels",
+			policy:   DepotSyncPolicySpread,
+			channels: &depotsync.Channels{Active: active, Dead: map[string]string{"old": depotsync.ChannelStateRotated}},
+			want:     map[string]float64{"primary": 50, "second": 100},
+		},
+		{
+			name:     "exhaustive source rotates unlisted channels",
+			policy:   DepotSyncPolicyPrimary,
+			channels: &depotsync.Channels{Active: active[:1], Exhaustive: true},
+			want:     map[string]float64{"primary": 100},
+		},
+		{
+			name:     "unknown channel users stay",
+			policy:   DepotSyncPolicySpread,
+			channels: &depotsync.Channels{Active: active},
+			want:     map[string]float64{},
+		},
+		{
+			name:     "none policy only reports dead channels",
+			policy:   DepotSyncPolicyNone,
+			channels: &depotsync.Channels{Active: active, Dead: map[string]string{"old": depotsync.ChannelStateBanned}},
+			want:     map[string]float64{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.DepotSync.Policy = tc.policy
+
+			w := NewWorker(nil, &cfg)
+
+			store := &depotSyncStoreMock{
+				used: []*types.UserChannelUsage{
+					{DepotChannelHash: "primary", TelegramChannelID: 1, TelegramChannelURL: "https://t.me/primary", Users: 5},
+					{DepotChannelHash: "old", TelegramChannelID: 3, TelegramChannelURL: "https://t.me/old", Users: 10},
+				},
+			}
+
+			if err := w.syncBotChannels(store, &sourceMock{channels: tc.channels}, &types.Bot{ID: 1}); err != nil {
+				t.Fatalf("syncBotChannels() error = %v", err)
+			}
+
+			if len(store.migrations) != len(tc.want) {
+				t.Fatalf("got %d migrations, want %d", len(store.migrations), len(tc.want))
+			}
+
+			for _, m := range store.migrations {
+				if m.FromDepotChannelHash != "old" || m.Reason != types.ChannelMigrationReasonSync {
+					t.Errorf("unexpected migration %+v", m)
+				}
+
+				if percent, ok := tc.want[m.ToDepotChannelHash]; !ok || m.Percent != percent {
+					t.Errorf("migration to %s of %v%%, want %v", m.ToDepotChannelHash, m.Percent, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncBotChannelsFollowsTelegramChannelChange(t *testing.T) {
+	cfg := NewConfig()
+	w := NewWorker(nil, &cfg)
+
+	store := &depotSyncStoreMock{
+		used: []*types.UserChannelUsage{
+			{DepotChannelHash: "primary", TelegramChannelID: 1, TelegramChannelURL: "https://t.me/old", Users: 5},
+		},
+	}
+
+	source := &sourceMock{channels: &depotsync.Channels{
+		Active: []*types.UserChannel{{DepotChannelHash: "primary", TelegramChannelID: 2, TelegramChannelURL: "https://t.me/new"}},
+	}}
+
+	if err := w.syncBotChannels(store, source, &types.Bot{ID: 1}); err != nil {
+		t.Fatalf("syncBotChannels() error = %v", err)
+	}
+
+	if len(store.migrations) != 1 || store.migrations[0].ToTelegramChannelID != 2 || store.migrations[0].Percent != 100 {
+		t.Fatalf("migrations = %+v, want one full move to telegram channel 2", store.migrations)
+	}
+}
@@ -0,0 +1,52 @@
+package depotsync
+
+import (
+	"fmt"
+
+	"github.com/prosperofair/pkg/depot"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// DepotSource asks depot for the channel it currently distributes the bot traffic to.
+type DepotSource struct {
+	client *depot.Client
+}
+
+func NewDepotSource(client *depot.Client) *DepotSource {
+	return &DepotSource{
+		client: client,
+	}
+}
+
+func (s *DepotSource) Name() string {
+	return "depot"
+}
+
+// Channels returns the current bot channel as the only active one. Depot distributes the bot
+// traffic to a single channel, so every other channel the users were invited to has been rotated.
+func (s *DepotSource) Channels(bot *types.Bot) (*Channels, error) {
+	channel, err := s.client.GetBotChannelByTDR(bot.BotToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bot channel: %w", err)
+	}
+
+	res := &Channels{
+		Active: make([]*types.UserChannel, 0),
+		Dead:   make(map[string]string),
+	}
+
+	// without a current channel depot has nothing to rotate to
+	if channel == nil {
+		return res, nil
+	}
+
+	res.Exhaustive = true
+	res.Active = append(res.Active, &types.UserChannel{
+		DepotChannelHash:   channel.Hash,
+		TelegramChannelID:  channel.TelegramChannelID,
+		TelegramChannelURL: channel.TelegramChannelURL,
+	})
+
+	return res, nil
+}
@@ -0,0 +1,61 @@
+package depotsync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// FileSource reads the channels from a json file mapping bot tokens to channel lists,
+// it stands in for depot when running locally. Channels without a state are active.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{
+		path: path,
+	}
+}
+
+func (s *FileSource) Name() string {
+	return "file"
+}
+
+type fileChannel struct {
+	types.UserChannel
+
+	State string `json:"state"`
+}
+
+func (s *FileSource) Channels(bot *types.Bot) (*Channels, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read channels file: %w", err)
+	}
+
+	channels := make(map[string][]*fileChannel)
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return nil, fmt.Errorf("failed to parse channels file: %w", err)
+	}
+
+	res := &Channels{
+		Active: make([]*types.UserChannel, 0),
+		Dead:   make(map[string]string),
+	}
+
+	for _, channel := range channels[bot.BotToken] {
+		switch channel.State {
+		case "", ChannelStateActive:
+			res.Active = append(res.Active, &channel.UserChannel)
+		case ChannelStateBanned, ChannelStateRotated:
+			res.Dead[channel.DepotChannelHash] = channel.State
+		default:
+			return nil, fmt.Errorf("invalid state %s of channel %s", channel.State, channel.DepotChannelHash)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,49 @@
+package depotsync
+
+import "github.com/prosperofair/stata/pkg/types"
+
+const (
+	// states of the channels listed by a source
+	ChannelStateActive  = "active"
+	ChannelStateBanned  = "banned"
+	ChannelStateRotated = "rotated"
+)
+
+// Channels is what the source knows about the bot channels, the first active channel is
+// the primary one receiving the users of dead channels. Channels missing from both lists
+// are in an unknown state and their users are left where they are, unless the source is exhaustive.
+type Channels struct {
+	Active []*types.UserChannel
+
+	// Dead maps the hashes of channels explicitly reported as banned or rotated to their state
+	Dead map[string]string
+
+	// Exhaustive is set when the active channels are the only ones the bot traffic goes to,
+	// every other channel is then treated as rotated
+	Exhaustive bool
+}
+
+// State returns the state of the channel and whether the source knows it.
+func (c *Channels) State(hash string) (string, bool) {
+	for _, channel := range c.Active {
+		if channel.DepotChannelHash == hash {
+			return ChannelStateActive, true
+		}
+	}
+
+	if state, ok := c.Dead[hash]; ok {
+		return state, true
+	}
+
+	if c.Exhaustive {
+		return ChannelStateRotated, true
+	}
+
+	return "", false
+}
+
+// Source lists the channels the bot users may currently be invited to.
+type Source interface {
+	Name() string
+	Channels(bot *types.Bot) (*Channels, error)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prosperofair/pkg/log"
+	"github.com/prosperofair/stata/pkg/expenses"
+	"github.com/prosperofair/stata/pkg/types"
+	"go.uber.org/zap"
+)
+
+func (w *Worker) expensesFetcher() error {
+	sources, err := w.expenseSources()
+	if err != nil {
+		return err
+	}
+
+	bots := make(map[string]*types.Bot)
+
+	for _, source := range sources {
+		log.Info("fetching expenses", zap.String("source", source.Name()))
+
+		records, err := source.Fetch()
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s expenses: %w", source.Name(), err)
+		}
+
+		imported := make([]*types.Expense, 0, len(records))
+		for _, expense := range records {
+			bot, ok := bots[expense.BotToken]
+			if !ok {
+				if bot, err = w.pg.SelectBotByToken(expense.BotToken); err != nil {
+					log.Error("failed to select expense bot",
+						zap.String("source", source.Name()), zap.String("label", expense.Label), zap.Error(err))
+					continue
+				}
+
+				bots[expense.BotToken] = bot
+			}
+
+			expense.BotID = bot.ID
+			expense.Source = source.Name()
+
+			if w.cfg.Worker.DryRun {
+				log.Info("dry run, skipping expense",
+					zap.String("source", expense.Source),
+					zap.Int("bot_id", expense.BotID),
+					zap.String("label", expense.Label),
+					zap.Time("date", expense.Date),
+					zap.Float64("spend", expense.Spend),
+				)
+				continue
+			}
+
+			imported = append(imported, expense)
+		}
+
+		if err := w.pg.ImportExpenses(imported); err != nil {
+			return fmt.Errorf("failed to import %s expenses: %w", source.Name(), err)
+		}
+
+		log.Info("fetched expenses", zap.String("source", source.Name()), zap.Int("records", len(records)))
+	}
+
+	return nil
+}
+
+// expenseSources builds the configured sources, csv urls are given as name=url pairs.
+func (w *Worker) expenseSources() ([]expenses.Source, error) {
+	sources := make([]expenses.Source, 0)
+
+	for _, pair := range w.cfg.Expenses.CSVURLs {
+		name, url, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || url == "" {
+			return nil, fmt.Errorf("invalid expenses csv url: %s", pair)
+		}
+
+		if utf8.RuneCountInString(name) > types.ExpenseSourceMaxLength {
+			return nil, fmt.Errorf("expenses source name is too long: %s", name)
+		}
+
+		sources = append(sources, expenses.NewCSVURLSource(name, url))
+	}
+
+	return sources, nil
+}
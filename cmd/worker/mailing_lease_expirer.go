@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prosperofair/pkg/log"
+	"go.uber.org/zap"
+)
+
+func (w *Worker) mailingLeaseExpirer() error {
+	released, err := w.pg.ExpireMailingLeases()
+	if err != nil {
+		return fmt.Errorf("failed to expire mailing leases: %w", err)
+	}
+
+	log.Info("expired mailing leases", zap.Int("released_users", released))
+
+	return nil
+}
@@ -51,6 +51,22 @@ func main() {
 		if err := runWorker(worker.onlineSnapshot, cfg.Worker.Timeout, cfg.Worker.SingleRun); err != nil {
 			log.Fatal("failed to run worker", zap.Error(err))
 		}
+	case WorkerMailingLeaseExpirer:
+		if err := runWorker(worker.mailingLeaseExpirer, cfg.Worker.Timeout, cfg.Worker.SingleRun); err != nil {
+			log.Fatal("failed to run worker", zap.Error(err))
+		}
+	case WorkerExpensesFetcher:
+		if err := runWorker(worker.expensesFetcher, cfg.Worker.Timeout, cfg.Worker.SingleRun); err != nil {
+			log.Fatal("failed to run worker", zap.Error(err))
+		}
+	case WorkerRetention:
+		if err := runWorker(worker.retention, cfg.Worker.Timeout, cfg.Worker.SingleRun); err != nil {
+			log.Fatal("failed to run worker", zap.Error(err))
+		}
+	case WorkerDepotSync:
+		if err := runWorker(worker.depotSync, cfg.Worker.Timeout, cfg.Worker.SingleRun); err != nil {
+			log.Fatal("failed to run worker", zap.Error(err))
+		}
 	}
 }
 
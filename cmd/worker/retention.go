@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prosperofair/pkg/log"
+	"go.uber.org/zap"
+)
+
+// retention downsamples and purges the tables by the configured retention periods,
+// a zero period keeps the table intact. In the dry run only the affected rows are reported.
+func (w *Worker) retention() error {
+	cfg := w.cfg.Retention
+	now := time.Now()
+
+	policies := []struct {
+		table  string
+		action string
+		after  time.Duration
+		run    func(cutoff time.Time, dryRun bool) (int, error)
+	}{
+		{"prices", "downsample hourly", cfg.PricesHourlyAfter, w.pg.DownsamplePrices},
+		{"snapshots", "rollup hourly", cfg.SnapshotsHourlyAfter, w.pg.RollupSnapshots},
+		{"fbtool_campaigns_stats", "delete", cfg.FBToolStatsTTL, func(cutoff time.Time, dryRun bool) (int, error) {
+			return w.pg.DeleteOlderThan("fbtool_campaigns_stats", "date", cutoff, dryRun)
+		}},
+		{"events_log", "delete", cfg.EventsLogTTL, func(cutoff time.Time, dryRun bool) (int, error) {
+			return w.pg.DeleteOlderThan("events_log", "created_at", cutoff, dryRun)
+		}},
+		{"mailing_deliveries", "delete", cfg.MailingDeliveriesTTL, func(cutoff time.Time, dryRun bool) (int, error) {
+			return w.pg.DeleteOlderThan("mailing_deliveries", "created_at", cutoff, dryRun)
+		}},
+	}
+
+	for _, policy := range policies {
+		if policy.after <= 0 {
+			continue
+		}
+
+		cutoff := now.Add(-policy.after)
+
+		rows, err := policy.run(cutoff, w.cfg.Worker.DryRun)
+		if err != nil {
+			return fmt.Errorf("failed to %s %s: %w", policy.action, policy.table, err)
+		}
+
+		log.Info("retention applied",
+			zap.String("table", policy.table),
+			zap.String("action", policy.action),
+			zap.Time("cutoff", cutoff),
+			zap.Int("rows", rows),
+			zap.Bool("dry_run", w.cfg.Worker.DryRun),
+		)
+	}
+
+	return nil
+}
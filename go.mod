@@ -17,6 +17,7 @@ require (
 	github.com/oschwald/geoip2-golang v1.11.0
 	github.com/prometheus/client_golang v1.17.0
 	github.com/prosperofair/pkg v0.0.0-20250821130837-cbdcf9a57518
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	go.uber.org/zap v1.26.0
 )
 
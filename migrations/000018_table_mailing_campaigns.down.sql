@@ -0,0 +1,2 @@
+drop table if exists mailing_campaign_users;
+drop table if exists mailing_campaigns;
@@ -0,0 +1,34 @@
+create table if not exists mailing_campaigns
+(
+    id                 serial
+        constraint mailing_campaigns_pk primary key,
+    bot_id             int          default 0        not null,
+    depot_channel_hash varchar(16)  default ''       not null,
+    name               varchar(255) default ''       not null,
+
+    state              varchar(32)  default 'active' not null,
+    started_at         timestamp    default now()    not null,
+    finished_at        timestamp    default now()    not null,
+
+    created_at         timestamp    default now()    not null,
+    updated_at         timestamp    default now()    not null
+);
+
+create index idx_mailing_campaigns_bot_id on mailing_campaigns (bot_id);
+
+create table if not exists mailing_campaign_users
+(
+    id          serial
+        constraint mailing_campaign_users_pk primary key,
+    campaign_id int          default 0        not null,
+    user_id     int          default 0        not null,
+
+    state       varchar(32)  default 'leased' not null,
+    error       varchar(255) default ''       not null,
+
+    created_at  timestamp    default now()    not null,
+    updated_at  timestamp    default now()    not null
+);
+
+alter table mailing_campaign_users
+    add constraint mailing_campaign_user_unique UNIQUE (campaign_id, user_id);
@@ -0,0 +1,6 @@
+drop index if exists idx_users_mailing_lease_id;
+
+alter table users
+    drop column if exists mailing_lease_id;
+
+drop table if exists mailing_leases;
@@ -0,0 +1,23 @@
+create table if not exists mailing_leases
+(
+    id                 serial
+        constraint mailing_leases_pk primary key,
+    lease_id           uuid                          not null unique,
+    bot_id             int          default 0        not null,
+    depot_channel_hash varchar(16)  default ''       not null,
+    campaign_id        int          default 0        not null,
+
+    state              varchar(32)  default 'active' not null,
+    users              int          default 0        not null,
+    expires_at         timestamp    default now()    not null,
+
+    created_at         timestamp    default now()    not null,
+    updated_at         timestamp    default now()    not null
+);
+
+create index idx_mailing_leases_state_expires_at on mailing_leases (state, expires_at);
+
+alter table users
+    add column if not exists mailing_lease_id uuid default '00000000-0000-0000-0000-000000000000' not null;
+
+create index idx_users_mailing_lease_id on users (mailing_lease_id);
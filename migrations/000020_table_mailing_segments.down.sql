@@ -0,0 +1,4 @@
+alter table mailing_campaigns
+    drop column if exists segment_id;
+
+drop table if exists mailing_segments;
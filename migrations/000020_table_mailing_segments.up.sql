@@ -0,0 +1,17 @@
+create table if not exists mailing_segments
+(
+    id         serial
+        constraint mailing_segments_pk primary key,
+    bot_id     int          default 0     not null,
+    name       varchar(255) default ''    not null,
+    filter     jsonb        default '{}'  not null,
+
+    created_at timestamp    default now() not null,
+    updated_at timestamp    default now() not null
+);
+
+alter table mailing_segments
+    add constraint mailing_segment_name_unique UNIQUE (bot_id, name);
+
+alter table mailing_campaigns
+    add column if not exists segment_id int default 0 not null;
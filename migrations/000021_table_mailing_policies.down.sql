@@ -0,0 +1,6 @@
+alter table users
+    drop column if exists mailed_at;
+
+drop index if exists idx_mailing_leases_bot_id_created_at;
+
+drop table if exists mailing_policies;
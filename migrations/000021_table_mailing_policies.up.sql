@@ -0,0 +1,23 @@
+create table if not exists mailing_policies
+(
+    id                serial
+        constraint mailing_policies_pk primary key,
+    bot_id            int          default 0     not null unique,
+
+    max_per_second    int          default 0     not null,
+    max_per_minute    int          default 0     not null,
+
+    quiet_hours_start int          default 0     not null,
+    quiet_hours_end   int          default 0     not null,
+    default_timezone  varchar(64)  default 'UTC' not null,
+
+    min_gap           int          default 0     not null,
+
+    created_at        timestamp    default now() not null,
+    updated_at        timestamp    default now() not null
+);
+
+create index idx_mailing_leases_bot_id_created_at on mailing_leases (bot_id, created_at);
+
+alter table users
+    add column if not exists mailed_at timestamp default '1970-01-01 00:00:00' not null;
@@ -0,0 +1,4 @@
+alter table users
+    drop column if exists mailing_error_reason;
+
+drop table if exists mailing_deliveries;
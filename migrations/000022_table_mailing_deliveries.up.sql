@@ -0,0 +1,20 @@
+create table if not exists mailing_deliveries
+(
+    id          serial
+        constraint mailing_deliveries_pk primary key,
+    bot_id      int         default 0     not null,
+    user_id     int         default 0     not null,
+    campaign_id int         default 0     not null,
+
+    event       varchar(16) default ''    not null,
+    reason      varchar(64) default ''    not null,
+    permanent   bool        default false not null,
+
+    created_at  timestamp   default now() not null
+);
+
+create index idx_mailing_deliveries_bot_id_created_at on mailing_deliveries (bot_id, created_at);
+create index idx_mailing_deliveries_user_id on mailing_deliveries (user_id);
+
+alter table users
+    add column if not exists mailing_error_reason varchar(64) default '' not null;
@@ -0,0 +1,10 @@
+drop index if exists idx_transactions_user_id;
+drop index if exists idx_events_log_user_id_event_type;
+
+alter table mailing_campaign_users
+    drop column if exists sent_at;
+
+alter table mailing_campaign_users
+    drop column if exists variant_id;
+
+drop table if exists mailing_campaign_variants;
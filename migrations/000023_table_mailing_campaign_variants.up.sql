@@ -0,0 +1,24 @@
+create table if not exists mailing_campaign_variants
+(
+    id          serial
+        constraint mailing_campaign_variants_pk primary key,
+    campaign_id int          default 0     not null,
+    name        varchar(255) default ''    not null,
+    weight      int          default 1     not null,
+    payload     text         default ''    not null,
+
+    created_at  timestamp    default now() not null,
+    updated_at  timestamp    default now() not null
+);
+
+alter table mailing_campaign_variants
+    add constraint mailing_campaign_variant_name_unique UNIQUE (campaign_id, name);
+
+alter table mailing_campaign_users
+    add column if not exists variant_id int default 0 not null;
+
+alter table mailing_campaign_users
+    add column if not exists sent_at timestamp default '1970-01-01 00:00:00' not null;
+
+create index if not exists idx_events_log_user_id_event_type on events_log (user_id, event_type);
+create index if not exists idx_transactions_user_id on transactions (user_id);
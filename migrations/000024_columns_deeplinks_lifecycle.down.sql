@@ -0,0 +1,6 @@
+drop table if exists deeplink_label_merges;
+
+alter table bots drop column if exists fallback_deeplink_id;
+alter table bots drop column if exists inactive_deeplink_policy;
+
+alter table deeplinks drop column if exists archived;
@@ -0,0 +1,16 @@
+alter table deeplinks add column if not exists archived boolean default false not null;
+
+alter table bots add column if not exists inactive_deeplink_policy varchar(16) default 'none' not null;
+alter table bots add column if not exists fallback_deeplink_id int default 0 not null;
+
+create table if not exists deeplink_label_merges
+(
+    id         serial
+        constraint deeplink_label_merges_pk primary key,
+    bot_id     int          default 0     not null,
+    from_label varchar(255) default ''    not null,
+    to_label   varchar(255) default ''    not null,
+    deeplinks  int          default 0     not null,
+
+    created_at timestamp    default now() not null
+);
@@ -0,0 +1,8 @@
+drop table if exists deeplink_fbtool_links;
+
+alter table deeplinks drop column if exists tags;
+alter table deeplinks drop column if exists buyer;
+alter table deeplinks drop column if exists creative;
+alter table deeplinks drop column if exists ad_set;
+alter table deeplinks drop column if exists campaign;
+alter table deeplinks drop column if exists source;
@@ -0,0 +1,22 @@
+alter table deeplinks add column if not exists source varchar(255) default '' not null;
+alter table deeplinks add column if not exists campaign varchar(255) default '' not null;
+alter table deeplinks add column if not exists ad_set varchar(255) default '' not null;
+alter table deeplinks add column if not exists creative varchar(255) default '' not null;
+alter table deeplinks add column if not exists buyer varchar(255) default '' not null;
+alter table deeplinks add column if not exists tags text[] default '{}' not null;
+
+create table if not exists deeplink_fbtool_links
+(
+    id                serial
+        constraint deeplink_fbtool_links_pk primary key,
+    deeplink_id       int          default 0     not null,
+    fbtool_account_id int          default 0     not null,
+    campaign_id       varchar(255) default ''    not null,
+
+    created_at        timestamp    default now() not null
+);
+
+alter table deeplink_fbtool_links
+    add constraint deeplink_fbtool_link_unique UNIQUE (deeplink_id, fbtool_account_id, campaign_id);
+
+create index idx_deeplink_fbtool_links_fbtool_account_id on deeplink_fbtool_links (fbtool_account_id);
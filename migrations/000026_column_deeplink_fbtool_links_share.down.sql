@@ -0,0 +1 @@
+alter table deeplink_fbtool_links drop column if exists share;
@@ -0,0 +1 @@
+alter table deeplink_fbtool_links add column if not exists share float default 100 not null;
@@ -0,0 +1,19 @@
+create table if not exists expenses
+(
+    id          serial
+        constraint expenses_pk primary key,
+    bot_id      int          default 0        not null,
+    label       varchar(255) default ''       not null,
+    source      varchar(64)  default 'manual' not null,
+
+    date        timestamp    default now()    not null,
+    spend       float        default 0        not null,
+    clicks      int          default 0        not null,
+    impressions int          default 0        not null,
+
+    created_at  timestamp    default now()    not null,
+    updated_at  timestamp    default now()    not null
+);
+
+alter table expenses
+    add constraint daily_expense UNIQUE (bot_id, label, source, date);
@@ -0,0 +1,20 @@
+create table if not exists deeplink_touches
+(
+    id          serial
+        constraint deeplink_touches_pk primary key,
+    user_id     int       default 0     not null,
+    deeplink_id int       default 0     not null,
+
+    created_at  timestamp default now() not null
+);
+
+create index if not exists deeplink_touches_user_id_created_at_index
+    on deeplink_touches (user_id, created_at);
+
+create index if not exists deeplink_touches_deeplink_id_index
+    on deeplink_touches (deeplink_id);
+
+insert into deeplink_touches (user_id, deeplink_id, created_at)
+select id, deeplink_id, created_at
+from users
+where deeplink_id <> 0;
@@ -0,0 +1,30 @@
+create table if not exists persons
+(
+    id             serial
+        constraint persons_pk primary key,
+    telegram_id    bigint    default 0     not null
+        constraint persons_telegram_id_key unique,
+
+    first_user_id  int       default 0     not null,
+    first_bot_id   int       default 0     not null,
+    bots           int       default 0     not null,
+
+    first_seen_at  timestamp default now() not null,
+    last_joined_at timestamp default now() not null,
+
+    created_at     timestamp default now() not null,
+    updated_at     timestamp default now() not null
+);
+
+create index if not exists persons_first_user_id_index
+    on persons (first_user_id);
+
+insert into persons (telegram_id, first_user_id, first_bot_id, bots, first_seen_at, last_joined_at)
+select telegram_id,
+       (array_agg(id order by created_at, id))[1],
+       (array_agg(bot_id order by created_at, id))[1],
+       count(distinct bot_id),
+       min(created_at),
+       max(created_at)
+from users
+group by telegram_id;
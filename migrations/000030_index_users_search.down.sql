@@ -0,0 +1,3 @@
+drop index if exists users_name_trgm_index;
+drop index if exists users_forward_sender_name_trgm_index;
+drop index if exists users_username_trgm_index;
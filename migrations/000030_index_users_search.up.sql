@@ -0,0 +1,10 @@
+create extension if not exists pg_trgm;
+
+create index if not exists users_username_trgm_index
+    on users using gin (username gin_trgm_ops);
+
+create index if not exists users_forward_sender_name_trgm_index
+    on users using gin (forward_sender_name gin_trgm_ops);
+
+create index if not exists users_name_trgm_index
+    on users using gin ((first_name || ' ' || last_name) gin_trgm_ops);
@@ -0,0 +1,2 @@
+alter table users
+    add column if not exists erased_at timestamp default '1970-01-01 00:00:00' not null;
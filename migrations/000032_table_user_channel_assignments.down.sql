@@ -0,0 +1,2 @@
+drop table if exists user_channel_assignments;
+drop table if exists channel_migrations;
@@ -0,0 +1,54 @@
+create table if not exists channel_migrations
+(
+    id                      serial
+        constraint channel_migrations_pk primary key,
+    bot_id                  int          default 0     not null,
+
+    from_depot_channel_hash varchar(255) default ''    not null,
+    to_depot_channel_hash   varchar(255) default ''    not null,
+    to_telegram_channel_id  bigint       default 0     not null,
+    to_telegram_channel_url varchar(255) default ''    not null,
+
+    percent                 float        default 100   not null,
+    segment                 jsonb        default '{}'  not null,
+    users                   int          default 0     not null,
+
+    created_at              timestamp    default now() not null
+);
+
+create index if not exists channel_migrations_bot_id_index
+    on channel_migrations (bot_id);
+
+create table if not exists user_channel_assignments
+(
+    id                   serial
+        constraint user_channel_assignments_pk primary key,
+    user_id              int          default 0                     not null,
+    bot_id               int          default 0                     not null,
+
+    depot_channel_hash   varchar(255) default ''                    not null,
+    telegram_channel_id  bigint       default 0                     not null,
+    telegram_channel_url varchar(255) default ''                    not null,
+
+    reason               varchar(32)  default ''                    not null,
+    migration_id         int          default 0                     not null,
+
+    previous_subscribed  bool         default false                 not null,
+    was_subscribed       bool         default false                 not null,
+
+    assigned_at          timestamp    default now()                 not null,
+    unassigned_at        timestamp    default '1970-01-01 00:00:00' not null
+);
+
+create index if not exists user_channel_assignments_user_id_index
+    on user_channel_assignments (user_id);
+
+create index if not exists user_channel_assignments_migration_id_index
+    on user_channel_assignments (migration_id);
+
+insert into user_channel_assignments (user_id, bot_id, depot_channel_hash, telegram_channel_id, telegram_channel_url,
+                                      reason, assigned_at)
+select id, bot_id, depot_channel_hash, telegram_channel_id, telegram_channel_url, 'backfill', created_at
+from users
+where depot_channel_hash <> ''
+   or telegram_channel_id <> 0;
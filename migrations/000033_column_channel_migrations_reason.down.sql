@@ -0,0 +1,2 @@
+alter table channel_migrations
+    drop column if exists reason;
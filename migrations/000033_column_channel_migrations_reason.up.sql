@@ -0,0 +1,2 @@
+alter table channel_migrations
+    add column if not exists reason varchar(32) default 'manual' not null;
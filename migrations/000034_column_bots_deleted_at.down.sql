@@ -0,0 +1,4 @@
+drop index if exists bots_bid_index;
+
+alter table bots
+    drop column if exists deleted_at;
@@ -0,0 +1,5 @@
+alter table bots
+    add column if not exists deleted_at timestamp default '1970-01-01 00:00:00' not null;
+
+create index if not exists bots_bid_index
+    on bots (bid);
@@ -0,0 +1,16 @@
+create table if not exists bot_token_aliases
+(
+    id         serial
+        constraint bot_token_aliases_pk primary key,
+    bot_id     int          default 0     not null,
+    bot_token  varchar(255) default ''    not null,
+
+    expires_at timestamp    default now() not null,
+    created_at timestamp    default now() not null
+);
+
+create index if not exists bot_token_aliases_bot_token_index
+    on bot_token_aliases (bot_token);
+
+create index if not exists bot_token_aliases_bot_id_index
+    on bot_token_aliases (bot_id);
@@ -0,0 +1,3 @@
+drop index if exists bots_trace_uuid_index;
+
+drop table if exists trace_groups;
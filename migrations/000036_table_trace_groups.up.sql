@@ -0,0 +1,25 @@
+create table if not exists trace_groups
+(
+    id                   serial
+        constraint trace_groups_pk primary key,
+    trace_uuid           varchar(36)  default ''            not null unique,
+    name                 varchar(255) default ''            not null,
+
+    depot_channel_hash   varchar(255) default ''            not null,
+    telegram_channel_id  bigint       default 0             not null,
+    telegram_channel_url varchar(255) default ''            not null,
+
+    binding_policy       varchar(32)  default 'oldest_user' not null,
+
+    created_at           timestamp    default now()         not null,
+    updated_at           timestamp    default now()         not null
+);
+
+insert into trace_groups (trace_uuid, name)
+select distinct trace_uuid, trace_uuid
+from bots
+where trace_uuid != '00000000-0000-0000-0000-000000000000'
+on conflict do nothing;
+
+create index if not exists bots_trace_uuid_index
+    on bots (trace_uuid);
@@ -0,0 +1 @@
+drop index if exists users_without_channel_index;
@@ -0,0 +1,3 @@
+create index if not exists users_without_channel_index
+    on users (id)
+    where depot_channel_hash = '' and telegram_channel_id = 0;
@@ -0,0 +1,90 @@
+package expenses
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// ParseCSV reads daily expenses from csv with a header row, date, label and spend columns
+// are required, clicks, impressions and bot_token are optional. Dates are formatted as YYYY-MM-DD.
+func ParseCSV(r io.Reader) ([]*types.Expense, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, name := range []string{"date", "label", "spend"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("csv column %s is missing", name)
+		}
+	}
+
+	value := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	res := make([]*types.Expense, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv line %d: %w", line, err)
+		}
+
+		expense := &types.Expense{
+			Label:    value(record, "label"),
+			BotToken: value(record, "bot_token"),
+		}
+
+		if expense.Label == "" {
+			return nil, fmt.Errorf("empty label on line %d", line)
+		}
+
+		if expense.Date, err = time.Parse(time.DateOnly, value(record, "date")); err != nil {
+			return nil, fmt.Errorf("invalid date on line %d: %w", line, err)
+		}
+
+		if expense.Spend, err = strconv.ParseFloat(value(record, "spend"), 64); err != nil {
+			return nil, fmt.Errorf("invalid spend on line %d: %w", line, err)
+		}
+
+		if v := value(record, "clicks"); v != "" {
+			if expense.Clicks, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid clicks on line %d: %w", line, err)
+			}
+		}
+
+		if v := value(record, "impressions"); v != "" {
+			if expense.Impressions, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid impressions on line %d: %w", line, err)
+			}
+		}
+
+		res = append(res, expense)
+	}
+
+	return res, nil
+}
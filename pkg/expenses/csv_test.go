@@ -0,0 +1,47 @@
+package expenses
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSV(t *testing.T) {
+	data := `Date, Label, Spend, Clicks, Impressions, Bot_Token
+2024-01-02, label, 12.5, 10, 100, token
+2024-01-03, other, 0,,,
+`
+
+	res, err := ParseCSV(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseCSV() error = %v", err)
+	}
+
+	if len(res) != 2 {
+		t.Fatalf("got %d expenses, want 2", len(res))
+	}
+
+	e := res[0]
+	if !e.Date.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) || e.Label != "label" || e.Spend != 12.5 ||
+		e.Clicks != 10 || e.Impressions != 100 || e.BotToken != "token" {
+		t.Errorf("first expense = %+v", e)
+	}
+
+	if e := res[1]; e.Label != "other" || e.Clicks != 0 || e.Impressions != 0 || e.BotToken != "" {
+		t.Errorf("second expense = %+v", e)
+	}
+}
+
+func TestParseCSVErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"missing column": "date,label\n2024-01-02,label\n",
+		"empty label":    "date,label,spend\n2024-01-02,,1\n",
+		"invalid date":   "date,label,spend\n02.01.2024,label,1\n",
+		"invalid spend":  "date,label,spend\n2024-01-02,label,abc\n",
+		"invalid clicks": "date,label,spend,clicks\n2024-01-02,label,1,1.5\n",
+	} {
+		if _, err := ParseCSV(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: ParseCSV() error = nil", name)
+		}
+	}
+}
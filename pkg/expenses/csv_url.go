@@ -0,0 +1,46 @@
+package expenses
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// CSVURLSource downloads expenses as csv from a url, e.g. a published spreadsheet
+// maintained by buyers for networks without an api.
+type CSVURLSource struct {
+	httpClient *http.Client
+
+	name string
+	url  string
+}
+
+func NewCSVURLSource(name, url string) *CSVURLSource {
+	return &CSVURLSource{
+		httpClient: &http.Client{
+			Timeout: time.Second * 30,
+		},
+		name: name,
+		url:  url,
+	}
+}
+
+func (s *CSVURLSource) Name() string {
+	return s.name
+}
+
+func (s *CSVURLSource) Fetch() ([]*types.Expense, error) {
+	resp, err := s.httpClient.Get(s.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download csv: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return ParseCSV(resp.Body)
+}
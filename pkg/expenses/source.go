@@ -0,0 +1,10 @@
+package expenses
+
+import "github.com/prosperofair/stata/pkg/types"
+
+// Source fetches daily spend from an ad network which is not covered by fbtool,
+// every returned expense must carry the bot token it belongs to.
+type Source interface {
+	Name() string
+	Fetch() ([]*types.Expense, error)
+}
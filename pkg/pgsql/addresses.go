@@ -74,6 +74,19 @@ func (c *Client) CreateTransaction(tx *types.Transaction) error {
 	return nil
 }
 
+func (c *Client) SelectUserTransactions(userID int) ([]*types.Transaction, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.Transaction, 0)
+
+	q := `select *, amount * price as usd from transactions where user_id = ? order by id desc`
+	if _, err := sess.SelectBySql(q, userID).Load(&res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (c *Client) SelectLastPricesByTicker() (map[string]*types.Price, error) {
 	sess := c.GetSession()
 	res := make([]*types.Price, 0)
@@ -0,0 +1,76 @@
+package pgsql
+
+import (
+	"fmt"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// CreateDeeplinkTouch records the user entry through the deeplink,
+// repeated entries through the deeplink of the latest touch are skipped.
+func (c *Client) CreateDeeplinkTouch(userID, deeplinkID int) error {
+	sess := c.GetSession()
+
+	q := `insert into deeplink_touches (user_id, deeplink_id)
+		  select ?, ?
+		  where coalesce((select deeplink_id
+						  from deeplink_touches
+						  where user_id = ?
+						  order by created_at desc, id desc
+						  limit 1), 0) <> ?`
+	if _, err := sess.InsertBySql(q, userID, deeplinkID, userID, deeplinkID).Exec(); err != nil {
+		return fmt.Errorf("failed to create deeplink touch: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectUserDeeplinkTouches(userID int) ([]*types.DeeplinkTouch, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.DeeplinkTouch, 0)
+
+	q := `select * from deeplink_touches where user_id = ? order by created_at, id`
+	if _, err := sess.SelectBySql(q, userID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select user deeplink touches: %w", err)
+	}
+
+	return res, nil
+}
+
+// deeplinkAttributionCTE renders the user_attribution common table expression weighting
+// the deeplinks of every bot user by the attribution model. First and last touch models give
+// the whole user to a single deeplink, the linear model splits the user evenly between touches.
+// Users attributed before touches were recorded fall back to their deeplink_id.
+func deeplinkAttributionCTE(botID int, model string) (string, []interface{}) {
+	touches := `touches as (select t.id, t.user_id, t.deeplink_id, t.created_at
+							from deeplink_touches t
+									 join users u on u.id = t.user_id
+							where u.bot_id = ?
+							union all
+							select 0, u.id, u.deeplink_id, u.created_at
+							from users u
+							where u.bot_id = ?
+							  and u.deeplink_id <> 0
+							  and not exists (select 1 from deeplink_touches t where t.user_id = u.id))`
+
+	var attribution string
+
+	switch model {
+	case types.AttributionModelLastTouch:
+		attribution = `user_attribution as (select distinct on (user_id) user_id, deeplink_id, 1::float as weight
+											from touches
+											order by user_id, created_at desc, id desc)`
+	case types.AttributionModelLinear:
+		attribution = `user_attribution as (select user_id,
+												   deeplink_id,
+												   1::float / count(*) over (partition by user_id) as weight
+											from touches)`
+	default:
+		attribution = `user_attribution as (select distinct on (user_id) user_id, deeplink_id, 1::float as weight
+											from touches
+											order by user_id, created_at, id)`
+	}
+
+	return touches + `, ` + attribution, []interface{}{botID, botID}
+}
@@ -1,17 +1,34 @@
 package pgsql
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocraft/dbr/v2"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/prosperofair/stata/pkg/types"
 )
 
+// botIDByTokenSQL resolves the bot id by its token, the previous token of a rotated bot
+// is accepted until its grace period expires. The token argument is passed twice.
+const botIDByTokenSQL = `coalesce(
+	(select id from bots where bot_token = ?),
+	(select bot_id from bot_token_aliases where bot_token = ? and expires_at > now() order by id desc limit 1)
+)`
+
 func (c *Client) SelectBotByToken(token string) (*types.Bot, error) {
 	sess := c.GetSession()
 
 	res := &types.Bot{}
 
-	q := `select * from bots where bot_token = ? limit 1`
-	if err := sess.SelectBySql(q, token).LoadOne(&res); err != nil {
+	q := `select * from bots where id = ` + botIDByTokenSQL + ` limit 1`
+	if err := sess.SelectBySql(q, token, token).LoadOne(&res); err != nil {
+		if errors.Is(err, dbr.ErrNotFound) {
+			return nil, ErrBotNotFound
+		}
 		return nil, err
 	}
 
@@ -36,6 +53,40 @@ func (c *Client) SelectAllBots() (map[int]*types.Bot, error) {
 	return bots, nil
 }
 
+func (c *Client) SelectBots(filter *types.BotsFilter) ([]*types.Bot, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.Bot, 0)
+
+	stmt := sess.Select("*").From("bots").OrderDesc("id")
+
+	if filter.BID != "" {
+		stmt.Where("bid = ?", filter.BID)
+	}
+
+	if filter.BotType != "" {
+		stmt.Where("bot_type = ?", filter.BotType)
+	}
+
+	if filter.Active != nil {
+		stmt.Where("active = ?", *filter.Active)
+	}
+
+	if filter.TraceUUID != nil {
+		stmt.Where("trace_uuid = ?", *filter.TraceUUID)
+	}
+
+	if !filter.IncludeDeleted {
+		stmt.Where("deleted_at = ?", time.Unix(0, 0).UTC())
+	}
+
+	if _, err := stmt.Load(&res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (c *Client) SelectBotIDsByTraceUUID(traceUUID uuid.UUID) ([]int, error) {
 	sess := c.GetSession()
 
@@ -94,37 +145,228 @@ func (c *Client) CreateBot(bot *types.Bot) error {
 	return nil
 }
 
-func (c *Client) UpdateBotBinding(botToken string, binding bool) error {
+// upsertBot creates the bot or updates the existing one with the same api key,
+// empty fields of the import don't overwrite the stored ones.
+func upsertBot(r dbr.SessionRunner, bot *types.Bot) (bool, error) {
+	res := make([]struct {
+		ID       int  `db:"id"`
+		Inserted bool `db:"inserted"`
+	}, 0, 1)
+
+	q := `
+		insert into bots (api_key, bot_token, bot_username, bot_type, bid, trace_uuid)
+		values (?, ?, ?, ?, ?, ?)
+		on conflict (api_key) do update
+			set bot_username = case when excluded.bot_username = '' then bots.bot_username else excluded.bot_username end,
+				bot_type     = case when excluded.bot_type = '' then bots.bot_type else excluded.bot_type end,
+				bid          = case when excluded.bid = '' then bots.bid else excluded.bid end,
+				trace_uuid   = case when excluded.trace_uuid = ? then bots.trace_uuid else excluded.trace_uuid end,
+				updated_at   = now()
+		returning id, xmax = 0 as inserted
+	`
+	if _, err := r.SelectBySql(q,
+		bot.APIKey,
+		bot.BotToken,
+		bot.BotUsername,
+		bot.BotType,
+		bot.BID,
+		bot.TraceUUID,
+		uuid.Nil,
+	).Load(&res); err != nil {
+		return false, err
+	}
+
+	if len(res) == 0 {
+		return false, errors.New("bot is not upserted")
+	}
+
+	bot.ID = res[0].ID
+
+	return res[0].Inserted, nil
+}
+
+// ImportBots upserts the bots reporting the outcome of each one. In atomic mode the import
+// runs in a single transaction and is rolled back on the first failure.
+func (c *Client) ImportBots(bots []*types.Bot, atomic bool) ([]*types.BotImportResult, error) {
 	sess := c.GetSession()
 
-	q := `update bots set binding = ? where bot_token = ?`
-	if _, err := sess.UpdateBySql(q, binding, botToken).Exec(); err != nil {
-		return err
+	res := make([]*types.BotImportResult, len(bots))
+	for i, bot := range bots {
+		res[i] = &types.BotImportResult{
+			Index:       i,
+			BotUsername: bot.BotUsername,
+			BotToken:    bot.BotToken,
+		}
 	}
 
-	return nil
+	if !atomic {
+		for i, bot := range bots {
+			inserted, err := upsertBot(sess, bot)
+			if err != nil {
+				res[i].Status = types.BotImportStatusFailed
+				res[i].Reason = err.Error()
+				continue
+			}
+
+			res[i].Status = importStatus(inserted)
+		}
+
+		return res, nil
+	}
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	for i, bot := range bots {
+		inserted, err := upsertBot(tx, bot)
+		if err != nil {
+			for _, r := range res {
+				r.Status = types.BotImportStatusFailed
+				r.Reason = "import is rolled back"
+			}
+
+			res[i].Reason = err.Error()
+
+			return res, nil
+		}
+
+		res[i].Status = importStatus(inserted)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import transaction: %w", err)
+	}
+
+	return res, nil
+}
+
+func importStatus(inserted bool) string {
+	if inserted {
+		return types.BotImportStatusCreated
+	}
+
+	return types.BotImportStatusUpdated
 }
 
-func (c *Client) UpdateBotTraceUUID(botToken string, traceUUID uuid.UUID) error {
+func (c *Client) UpdateBotBinding(botID int, binding bool) error {
 	sess := c.GetSession()
 
-	q := `update bots set trace_uuid = ? where bot_token = ?`
-	if _, err := sess.UpdateBySql(q, traceUUID, botToken).Exec(); err != nil {
-		return err
+	q := `update bots set binding = ?, updated_at = now() where id = ?`
+
+	return botUpdated(sess.UpdateBySql(q, binding, botID).Exec())
+}
+
+func (c *Client) UpdateBotTraceUUID(botID int, traceUUID uuid.UUID) error {
+	sess := c.GetSession()
+
+	q := `update bots set trace_uuid = ?, updated_at = now() where id = ?`
+
+	return botUpdated(sess.UpdateBySql(q, traceUUID, botID).Exec())
+}
+
+func (c *Client) UpdateBotBuyerID(botID int, bid string) error {
+	sess := c.GetSession()
+
+	q := `update bots set bid = ?, updated_at = now() where id = ?`
+
+	return botUpdated(sess.UpdateBySql(q, bid, botID).Exec())
+}
+
+// RotateBotToken replaces the api key and token of the bot keeping its id and history,
+// the previous token is kept as an alias until the grace period expires.
+func (c *Client) RotateBotToken(bot *types.Bot, apiKey, botToken string, grace time.Duration) (*types.BotTokenAlias, error) {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin tx: %w", err)
 	}
+	defer tx.RollbackUnlessCommitted()
 
-	return nil
+	alias := &types.BotTokenAlias{}
+
+	q := `
+		insert into bot_token_aliases (bot_id, bot_token, expires_at)
+		values (?, ?, now() + ? * interval '1 second')
+		returning *
+	`
+	if err := tx.SelectBySql(q, bot.ID, bot.BotToken, int64(grace.Seconds())).LoadOne(alias); err != nil {
+		return nil, fmt.Errorf("failed to create bot token alias: %w", err)
+	}
+
+	q = `update bots set api_key = ?, bot_token = ?, updated_at = now() where id = ?`
+	if _, err := tx.UpdateBySql(q, apiKey, botToken, bot.ID).Exec(); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" {
+				return nil, ErrAlreadyExists
+			}
+		}
+		return nil, fmt.Errorf("failed to update bot token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit tx: %w", err)
+	}
+
+	return alias, nil
 }
 
-func (c *Client) UpdateBotBuyerID(botToken string, bid string) error {
+func (c *Client) SelectActiveBotTokenAliases() ([]*types.BotTokenAlias, error) {
 	sess := c.GetSession()
 
-	if _, err := sess.Update("bots").
-		Set("bid", bid).
-		Where("bot_token = ?", botToken).
-		Exec(); err != nil {
+	res := make([]*types.BotTokenAlias, 0)
+
+	q := `select * from bot_token_aliases where expires_at > now() order by id`
+	if _, err := sess.SelectBySql(q).Load(&res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// UpdateBotActive switches the bot, deleted bots can't be activated again.
+func (c *Client) UpdateBotActive(botID int, active bool) error {
+	sess := c.GetSession()
+
+	q := `update bots set active = ?, updated_at = now() where id = ? and deleted_at = ?`
+
+	return botUpdated(sess.UpdateBySql(q, active, botID, time.Unix(0, 0).UTC()).Exec())
+}
+
+// DeleteBot deactivates the bot and hides it from the bots list, its users and reports are kept.
+func (c *Client) DeleteBot(botID int) error {
+	sess := c.GetSession()
+
+	q := `update bots set active = false, deleted_at = now(), updated_at = now() where id = ?`
+
+	return botUpdated(sess.UpdateBySql(q, botID).Exec())
+}
+
+func (c *Client) UpdateBotInactiveDeeplinkPolicy(botID int, policy string, fallbackDeeplinkID int) error {
+	sess := c.GetSession()
+
+	q := `update bots set inactive_deeplink_policy = ?, fallback_deeplink_id = ?, updated_at = now() where id = ?`
+
+	return botUpdated(sess.UpdateBySql(q, policy, fallbackDeeplinkID, botID).Exec())
+}
+
+// botUpdated returns ErrBotNotFound when the update matched no bot.
+func botUpdated(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
 		return err
 	}
 
+	if affected == 0 {
+		return ErrBotNotFound
+	}
+
 	return nil
 }
@@ -0,0 +1,267 @@
+package pgsql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/lib/pq"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// unassignedAt is the unassigned_at of open channel assignments.
+var unassignedAt = time.Unix(0, 0).UTC()
+
+// closeUserChannelAssignments ends the open channel assignments of the users remembering their subscription.
+func closeUserChannelAssignments(r dbr.SessionRunner, ids []int) error {
+	q := `update user_channel_assignments a
+		  set unassigned_at  = now(),
+			  was_subscribed = u.subscribed
+		  from users u
+		  where u.id = a.user_id
+			and a.user_id = any (?)
+			and a.unassigned_at = ?`
+	if _, err := r.UpdateBySql(q, pq.Array(ids), unassignedAt).Exec(); err != nil {
+		return fmt.Errorf("failed to close user channel assignments: %w", err)
+	}
+
+	return nil
+}
+
+// openUserChannelAssignments records the current channel of the users, users without a channel are skipped.
+func openUserChannelAssignments(r dbr.SessionRunner, ids []int, reason string, migrationID int) error {
+	q := `insert into user_channel_assignments (user_id, bot_id, depot_channel_hash, telegram_channel_id,
+												telegram_channel_url, reason, migration_id, previous_subscribed)
+		  select u.id,
+				 u.bot_id,
+				 u.depot_channel_hash,
+				 u.telegram_channel_id,
+				 u.telegram_channel_url,
+				 ?,
+				 ?,
+				 coalesce((select p.was_subscribed
+						   from user_channel_assignments p
+						   where p.user_id = u.id
+						   order by p.id desc
+						   limit 1), false)
+		  from users u
+		  where u.id = any (?)
+			and (u.depot_channel_hash <> '' or u.telegram_channel_id <> 0)`
+	if _, err := r.InsertBySql(q, reason, migrationID, pq.Array(ids)).Exec(); err != nil {
+		return fmt.Errorf("failed to open user channel assignments: %w", err)
+	}
+
+	return nil
+}
+
+// ReassignUsersChannel moves the users to the channel recording the assignment history,
+// the subscription is reset the same way channel updates always did.
+func (c *Client) ReassignUsersChannel(ids []int, channel *types.UserChannel, reason string, migrationID int) error {
+	sess := c.GetSession()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin reassign transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if err := c.reassignUsersChannel(tx, ids, channel, reason, migrationID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *Client) reassignUsersChannel(r dbr.SessionRunner, ids []int, channel *types.UserChannel, reason string, migrationID int) error {
+	if err := closeUserChannelAssignments(r, ids); err != nil {
+		return err
+	}
+
+	q := `update users
+	set depot_channel_hash   = ?,
+		telegram_channel_id  = ?,
+		telegram_channel_url = ?,
+		subscribed = false,
+		subscribed_at = created_at,
+		unsubscribed_at = created_at,
+		updated_at = now()
+	where id = any (?)`
+	if _, err := r.UpdateBySql(q,
+		channel.DepotChannelHash,
+		channel.TelegramChannelID,
+		channel.TelegramChannelURL,
+		pq.Array(ids),
+	).Exec(); err != nil {
+		return fmt.Errorf("failed to reassign users channel: %w", err)
+	}
+
+	return openUserChannelAssignments(r, ids, reason, migrationID)
+}
+
+func (c *Client) SelectUserChannelAssignments(userID int) ([]*types.UserChannelAssignment, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.UserChannelAssignment, 0)
+
+	q := `select * from user_channel_assignments where user_id = ? order by id`
+	if _, err := sess.SelectBySql(q, userID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select user channel assignments: %w", err)
+	}
+
+	return res, nil
+}
+
+// MigrateUsersChannel moves the percent of the segment users of the source channel to the target channel
+// picked at random. In the dry run only the number of users to move is counted.
+func (c *Client) MigrateUsersChannel(migration *types.ChannelMigration, dryRun bool) error {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	cond, args := segmentCondition(&migration.Segment)
+
+	total := make([]int, 0)
+
+	q := `select count(*) from users where bot_id = ? and depot_channel_hash = ?` + cond
+	params := append([]interface{}{migration.BotID, migration.FromDepotChannelHash}, args...)
+	if _, err := tx.SelectBySql(q, params...).Load(&total); err != nil {
+		return fmt.Errorf("failed to count migration users: %w", err)
+	}
+
+	limit := 0
+	if len(total) > 0 {
+		limit = int(float64(total[0])*migration.Percent/100 + 0.5)
+	}
+
+	ids := make([]int, 0)
+
+	q = `select id from users where bot_id = ? and depot_channel_hash = ?` + cond + ` order by random() limit ? for update`
+	if _, err := tx.SelectBySql(q, append(params, limit)...).Load(&ids); err != nil {
+		return fmt.Errorf("failed to select migration users: %w", err)
+	}
+
+	migration.Users = len(ids)
+
+	if dryRun {
+		return nil
+	}
+
+	if err := tx.InsertInto("channel_migrations").
+		Columns(
+			"bot_id",
+			"from_depot_channel_hash",
+			"to_depot_channel_hash",
+			"to_telegram_channel_id",
+			"to_telegram_channel_url",
+			"percent",
+			"segment",
+			"users",
+			"reason",
+		).
+		Record(migration).
+		Returning("id", "created_at").
+		Load(migration); err != nil {
+		return fmt.Errorf("failed to create channel migration: %w", err)
+	}
+
+	reason := types.ChannelAssignmentReasonMigration
+	if migration.Reason == types.ChannelMigrationReasonSync {
+		reason = types.ChannelAssignmentReasonSync
+	}
+
+	if err := c.reassignUsersChannel(tx, ids, &types.UserChannel{
+		DepotChannelHash:   migration.ToDepotChannelHash,
+		TelegramChannelID:  migration.ToTelegramChannelID,
+		TelegramChannelURL: migration.ToTelegramChannelURL,
+	}, reason, migration.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SelectBotUsersChannels returns the distinct channels the bot users are assigned to.
+func (c *Client) SelectBotUsersChannels(botID int) ([]*types.UserChannelUsage, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.UserChannelUsage, 0)
+
+	q := `select depot_channel_hash, telegram_channel_id, telegram_channel_url, count(*) as users
+		  from users
+		  where bot_id = ?
+			and depot_channel_hash <> ''
+		  group by depot_channel_hash, telegram_channel_id, telegram_channel_url
+		  order by users desc`
+	if _, err := sess.SelectBySql(q, botID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select bot users channels: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectBotChannelMigrations(botID int) ([]*types.ChannelMigration, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.ChannelMigration, 0)
+
+	q := `select * from channel_migrations where bot_id = ? order by id desc`
+	if _, err := sess.SelectBySql(q, botID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select channel migrations: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectChannelMigration(id int) (*types.ChannelMigration, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.ChannelMigration, 0)
+
+	q := `select * from channel_migrations where id = ?`
+	if _, err := sess.SelectBySql(q, id).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select channel migration: %w", err)
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res[0], nil
+}
+
+// SelectChannelMigrationReport counts the migrated users subscribed to the source channel when they were moved
+// and to the target channel now, or when they left it.
+func (c *Client) SelectChannelMigrationReport(migrationID int) (*types.ChannelMigrationReport, error) {
+	sess := c.GetSession()
+
+	res := &types.ChannelMigrationReport{}
+
+	q := `select ?                                                                  as migration_id,
+				 count(*)                                                           as users,
+				 count(*) filter (where a.previous_subscribed)                      as subscribed_before,
+				 count(*) filter (where case
+											when a.unassigned_at = ? then u.subscribed
+											else a.was_subscribed end)          as subscribed_after
+		  from user_channel_assignments a
+				   join users u on u.id = a.user_id
+		  where a.migration_id = ?`
+	if err := sess.SelectBySql(q, migrationID, unassignedAt, migrationID).LoadOne(res); err != nil {
+		return nil, fmt.Errorf("failed to select channel migration report: %w", err)
+	}
+
+	if res.Users > 0 {
+		res.SubscribedBeforeRate = float64(res.SubscribedBefore) / float64(res.Users) * 100
+		res.SubscribedAfterRate = float64(res.SubscribedAfter) / float64(res.Users) * 100
+	}
+
+	return res, nil
+}
@@ -6,7 +6,23 @@ import (
 	"github.com/gocraft/dbr/v2"
 )
 
-var ErrAlreadyExists = errors.New("err_already_exists")
+var (
+	ErrAlreadyExists  = errors.New("err_already_exists")
+	ErrPersonNotFound = errors.New("person not found")
+	ErrBotNotFound    = errors.New("bot not found")
+
+	ErrMailingSegmentInUse  = errors.New("mailing segment is used by active campaigns")
+	ErrMailingLeaseNotFound = errors.New("mailing lease not found")
+
+	ErrDeeplinkNotFound           = errors.New("deeplink not found or archived")
+	ErrDeeplinkFBToolLinkNotFound = errors.New("deeplink fbtool link not found")
+
+	ErrFBToolAccountNotFound = errors.New("fbtool account not found")
+
+	ErrExpenseNotFound = errors.New("expense not found")
+
+	ErrTraceGroupNotFound = errors.New("trace group not found")
+)
 
 type Client struct {
 	pgdb *dbr.Connection
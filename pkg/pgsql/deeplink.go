@@ -1,7 +1,11 @@
 package pgsql
 
 import (
+	"errors"
 	"fmt"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/lib/pq"
 	"github.com/prosperofair/pkg/log"
 	"github.com/prosperofair/stata/pkg/types"
 )
@@ -9,12 +13,22 @@ import (
 func (c *Client) CreateDeeplink(deeplink *types.Deeplink) error {
 	sess := c.GetSession()
 
+	if deeplink.Tags == nil {
+		deeplink.Tags = pq.StringArray{}
+	}
+
 	if _, err := sess.InsertInto("deeplinks").
 		Columns(
 			"bot_id",
 			"referral_telegram_id",
 			"hash",
 			"label",
+			"source",
+			"campaign",
+			"ad_set",
+			"creative",
+			"buyer",
+			"tags",
 		).Record(deeplink).Exec(); err != nil {
 		return err
 	}
@@ -22,6 +36,87 @@ func (c *Client) CreateDeeplink(deeplink *types.Deeplink) error {
 	return nil
 }
 
+// CreateDeeplinks inserts all deeplinks at once, ErrAlreadyExists is returned
+// when one of the hashes is taken by the bot and nothing is inserted.
+func (c *Client) CreateDeeplinks(deeplinks []*types.Deeplink) error {
+	sess := c.GetSession()
+
+	stmt := sess.InsertInto("deeplinks").Columns(
+		"bot_id",
+		"referral_telegram_id",
+		"hash",
+		"label",
+		"source",
+		"campaign",
+		"ad_set",
+		"creative",
+		"buyer",
+		"tags",
+	)
+
+	for _, deeplink := range deeplinks {
+		if deeplink.Tags == nil {
+			deeplink.Tags = pq.StringArray{}
+		}
+
+		stmt = stmt.Record(deeplink)
+	}
+
+	res := make([]*types.Deeplink, 0, len(deeplinks))
+	if err := stmt.Returning(
+		"id",
+		"hash",
+		"active",
+		"created_at",
+		"updated_at",
+	).Load(&res); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+
+	created := make(map[string]*types.Deeplink, len(res))
+	for _, deeplink := range res {
+		created[deeplink.Hash] = deeplink
+	}
+
+	for _, deeplink := range deeplinks {
+		if d, ok := created[deeplink.Hash]; ok {
+			deeplink.ID = d.ID
+			deeplink.Active = d.Active
+			deeplink.CreatedAt = d.CreatedAt
+			deeplink.UpdatedAt = d.UpdatedAt
+		}
+	}
+
+	return nil
+}
+
+// SelectBotExistingDeeplinkHashes returns which of the hashes are already taken by the bot.
+func (c *Client) SelectBotExistingDeeplinkHashes(botID int, hashes []string) (map[string]struct{}, error) {
+	sess := c.GetSession()
+
+	res := make(map[string]struct{})
+	if len(hashes) == 0 {
+		return res, nil
+	}
+
+	existing := make([]string, 0)
+
+	q := `select hash from deeplinks where bot_id = ? and hash in ?`
+	if _, err := sess.SelectBySql(q, botID, hashes).Load(&existing); err != nil {
+		return nil, err
+	}
+
+	for _, hash := range existing {
+		res[hash] = struct{}{}
+	}
+
+	return res, nil
+}
+
 func (c *Client) CreateDeeplinksIgnoreInsertErrorsReturningAll(deeplink []types.Deeplink) ([]types.Deeplink, error) {
 	sess := c.GetSession()
 
@@ -76,6 +171,167 @@ func (c *Client) UpdateDeeplinkLabel(botID int, hash, label string) error {
 	return nil
 }
 
+func (c *Client) UpdateDeeplinkMetadata(botID int, hash string, deeplink *types.Deeplink) error {
+	sess := c.GetSession()
+
+	if deeplink.Tags == nil {
+		deeplink.Tags = pq.StringArray{}
+	}
+
+	q := `update deeplinks
+		  set source     = ?,
+			  campaign   = ?,
+			  ad_set     = ?,
+			  creative   = ?,
+			  buyer      = ?,
+			  tags       = ?,
+			  updated_at = now()
+		  where bot_id = ?
+			and hash = ?
+			and archived = false`
+	res, err := sess.UpdateBySql(q,
+		deeplink.Source,
+		deeplink.Campaign,
+		deeplink.AdSet,
+		deeplink.Creative,
+		deeplink.Buyer,
+		deeplink.Tags,
+		botID,
+		hash,
+	).Exec()
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrDeeplinkNotFound
+	}
+
+	return nil
+}
+
+// UpdateDeeplinkActive switches the deeplink state, deactivating the bot fallback deeplink
+// resets the bot inactive deeplink policy so users aren't attributed to an inactive deeplink.
+func (c *Client) UpdateDeeplinkActive(botID int, hash string, active bool) error {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	ids := make([]int, 0)
+
+	q := `update deeplinks set active = ?, updated_at = now() where bot_id = ? and hash = ? and archived = false returning id`
+	if _, err := tx.SelectBySql(q, active, botID, hash).Load(&ids); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return ErrDeeplinkNotFound
+	}
+
+	if !active {
+		if err := resetBotFallbackDeeplink(tx, botID, ids); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ArchiveDeeplink deactivates the deeplink and hides it from listings,
+// users attributed to it keep their history.
+func (c *Client) ArchiveDeeplink(botID int, hash string) error {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	ids := make([]int, 0)
+
+	q := `update deeplinks set active = false, archived = true, updated_at = now() where bot_id = ? and hash = ? returning id`
+	if _, err := tx.SelectBySql(q, botID, hash).Load(&ids); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return ErrDeeplinkNotFound
+	}
+
+	if err := resetBotFallbackDeeplink(tx, botID, ids); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func resetBotFallbackDeeplink(r dbr.SessionRunner, botID int, deeplinkIDs []int) error {
+	q := `
+		update bots
+		set inactive_deeplink_policy = ?,
+			fallback_deeplink_id     = 0,
+			updated_at               = now()
+		where id = ?
+		  and fallback_deeplink_id in ?`
+	if _, err := r.UpdateBySql(q, types.DeeplinkInactivePolicyNone, botID, deeplinkIDs).Exec(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MergeDeeplinkLabels moves all deeplinks of the label to another one, so the history of both
+// labels is reported together. The merge is recorded for audit.
+func (c *Client) MergeDeeplinkLabels(botID int, from, to string) (*types.DeeplinkLabelMerge, error) {
+	sess := c.GetSession()
+
+	res := &types.DeeplinkLabelMerge{}
+
+	q := `
+		with moved as (update deeplinks
+					   set label      = ?,
+						   updated_at = now()
+					   where bot_id = ?
+						 and label = ?
+					   returning id)
+		insert into deeplink_label_merges (bot_id, from_label, to_label, deeplinks)
+		select ?, ?, ?, count(*)
+		from moved
+		returning *
+	`
+	if err := sess.SelectBySql(q, to, botID, from, botID, from, to).LoadOne(res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectDeeplinkByID(id int) (*types.Deeplink, error) {
+	sess := c.GetSession()
+
+	res := &types.Deeplink{}
+
+	q := `select * from deeplinks where id = ?`
+	if err := sess.SelectBySql(q, id).LoadOne(res); err != nil {
+		if errors.Is(err, dbr.ErrNotFound) {
+			return nil, ErrDeeplinkNotFound
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (c *Client) SelectBotDeeplinksByHash(botID int, hash string) ([]*types.Deeplink, error) {
 	sess := c.GetSession()
 
@@ -16,3 +16,16 @@ func (c *Client) CreateEventLog(el *types.EventsLog) error {
 
 	return nil
 }
+
+func (c *Client) SelectUserEventsLogs(userID, limit int) ([]*types.EventsLog, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.EventsLog, 0)
+
+	q := `select * from events_log where user_id = ? order by id desc limit ?`
+	if _, err := sess.SelectBySql(q, userID, limit).Load(&res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
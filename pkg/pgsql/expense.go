@@ -0,0 +1,129 @@
+package pgsql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// UpsertExpense stores the daily spend of the label, repeated imports of the same day and source overwrite it.
+func (c *Client) UpsertExpense(expense *types.Expense) error {
+	sess := c.GetSession()
+
+	return upsertExpense(sess, expense)
+}
+
+// ImportExpenses upserts all expenses in one transaction, nothing is stored if one of them fails.
+func (c *Client) ImportExpenses(expenses []*types.Expense) error {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin expenses import transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	for _, expense := range expenses {
+		if err := upsertExpense(tx, expense); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit expenses import transaction: %w", err)
+	}
+
+	return nil
+}
+
+func upsertExpense(r dbr.SessionRunner, expense *types.Expense) error {
+	q := `insert into expenses (bot_id, label, source, date, spend, clicks, impressions)
+		  values (?, ?, ?, date(?), ?, ?, ?)
+		  on conflict (bot_id, label, source, date) do update set spend       = excluded.spend,
+																  clicks      = excluded.clicks,
+																  impressions = excluded.impressions,
+																  updated_at  = now()
+		  returning *`
+	if err := r.SelectBySql(q,
+		expense.BotID,
+		expense.Label,
+		expense.Source,
+		expense.Date,
+		expense.Spend,
+		expense.Clicks,
+		expense.Impressions,
+	).LoadOne(expense); err != nil {
+		return fmt.Errorf("failed to upsert expense: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectBotExpenses(botID int, start, end time.Time) ([]*types.Expense, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.Expense, 0)
+
+	q := `select *
+		  from expenses
+		  where bot_id = ?
+			and (date(date) > date(?) and date(date) <= date(?))
+		  order by date desc, label`
+	if _, err := sess.SelectBySql(q, botID, start, end).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select bot expenses: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) DeleteExpense(botID, id int) error {
+	sess := c.GetSession()
+
+	q := `delete from expenses where bot_id = ? and id = ?`
+	res, err := sess.DeleteBySql(q, botID, id).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to delete expense: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrExpenseNotFound
+	}
+
+	return nil
+}
+
+// SelectBotLabelsWithoutDeeplinks returns the labels no deeplink of the bot carries,
+// expenses of these labels aren't attributed to any deeplink.
+func (c *Client) SelectBotLabelsWithoutDeeplinks(botID int, labels []string) (map[string]struct{}, error) {
+	sess := c.GetSession()
+
+	res := make(map[string]struct{})
+	if len(labels) == 0 {
+		return res, nil
+	}
+
+	matched := make([]string, 0)
+
+	q := `select distinct label from deeplinks where bot_id = ? and label in ?`
+	if _, err := sess.SelectBySql(q, botID, labels).Load(&matched); err != nil {
+		return nil, fmt.Errorf("failed to select deeplink labels: %w", err)
+	}
+
+	for _, label := range labels {
+		res[label] = struct{}{}
+	}
+
+	for _, label := range matched {
+		delete(res, label)
+	}
+
+	return res, nil
+}
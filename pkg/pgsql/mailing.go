@@ -0,0 +1,723 @@
+package pgsql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gocraft/dbr/v2"
+	"github.com/google/uuid"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// CreateMailingCampaign creates the campaign with its variants in one transaction.
+func (c *Client) CreateMailingCampaign(campaign *types.MailingCampaign, variants []*types.MailingCampaignVariant) error {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin mailing campaign transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if err := tx.InsertInto("mailing_campaigns").
+		Columns(
+			"bot_id",
+			"depot_channel_hash",
+			"name",
+			"segment_id",
+		).
+		Record(campaign).
+		Returning("id", "state", "started_at", "finished_at", "created_at", "updated_at").
+		Load(campaign); err != nil {
+		return fmt.Errorf("failed to create mailing campaign: %w", err)
+	}
+
+	for _, variant := range variants {
+		variant.CampaignID = campaign.ID
+
+		if err := tx.InsertInto("mailing_campaign_variants").
+			Columns(
+				"campaign_id",
+				"name",
+				"weight",
+				"payload",
+			).
+			Record(variant).
+			Returning("id", "created_at", "updated_at").
+			Load(variant); err != nil {
+			return fmt.Errorf("failed to create mailing campaign variant: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit mailing campaign transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectMailingCampaign(id int) (*types.MailingCampaign, error) {
+	sess := c.GetSession()
+
+	res := &types.MailingCampaign{}
+
+	q := `select * from mailing_campaigns where id = ?`
+	if err := sess.SelectBySql(q, id).LoadOne(res); err != nil {
+		return nil, fmt.Errorf("failed to select mailing campaign: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectBotMailingCampaigns(botID int) ([]*types.MailingCampaign, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.MailingCampaign, 0)
+
+	q := `select * from mailing_campaigns where bot_id = ? order by id desc`
+	if _, err := sess.SelectBySql(q, botID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select bot mailing campaigns: %w", err)
+	}
+
+	return res, nil
+}
+
+// LeaseMailingCampaignUsers creates the lease capped by the rate windows, picks random ready users of the
+// campaign channel which were not mailed by the campaign yet, moves them to in-progress under the lease
+// and attaches them to the campaign with their variants. Returns the leased users and their variants by telegram id.
+func (c *Client) LeaseMailingCampaignUsers(campaign *types.MailingCampaign, lease *types.MailingLease, ttl time.Duration, windows []types.MailingRateWindow, filter *types.MailingSegmentFilter, limit int) ([]*types.User, map[int64]*types.MailingCampaignVariant, error) {
+	tx, limit, err := c.beginMailingLease(lease, ttl, windows, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	res := make([]*types.User, 0)
+
+	cond, args := segmentCondition(filter)
+
+	q := `
+		with leased as (select id
+						from users
+						where mailing_state = ?
+						  and bot_id = ?
+						  and depot_channel_hash = ?
+						  and not exists (select 1
+										  from mailing_campaign_users mcu
+										  where mcu.campaign_id = ?
+											and mcu.user_id = users.id)` + notErasedCondition + cond + `
+						order by random()
+						limit ? for update skip locked),
+			 updated as (update users
+						 set mailing_state            = ?,
+							 mailing_lease_id         = ?,
+							 mailing_state_updated_at = now()
+						 where id in (select id from leased)
+						 returning users.*),
+			 attached as (insert into mailing_campaign_users (campaign_id, user_id)
+						  select ?, id
+						  from updated)
+		select *
+		from updated
+	`
+	params := []interface{}{
+		types.UserMailingStateReady,
+		campaign.BotID,
+		campaign.DepotChannelHash,
+		campaign.ID,
+	}
+	params = append(params, args...)
+	params = append(params,
+		limit,
+		types.UserMailingStateInProgress,
+		lease.LeaseID,
+		campaign.ID,
+	)
+
+	if _, err := tx.SelectBySql(q, params...).Load(&res); err != nil {
+		return nil, nil, fmt.Errorf("failed to lease mailing campaign users: %w", err)
+	}
+
+	variants, err := assignMailingCampaignVariants(tx, campaign.ID, res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := updateMailingLeaseUsers(tx, lease, len(res)); err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit mailing lease transaction: %w", err)
+	}
+
+	return res, variants, nil
+}
+
+func (c *Client) UpdateMailingCampaignUserState(campaignID, botID int, telegramID int64, state, reason string) error {
+	sess := c.GetSession()
+
+	reason = types.TruncateMailingError(reason, types.MailingCampaignUserErrorMaxLength)
+
+	// sent_at is only recorded when the message is delivered, so later updates don't move the attribution window
+	q := `update mailing_campaign_users
+	set state      = ?,
+		error      = ?,
+		sent_at    = case when ? = ? then now() else sent_at end,
+		updated_at = now()
+	where campaign_id = ?
+	  and user_id in (select id from users where bot_id = ? and telegram_id = ?)`
+	if _, err := sess.UpdateBySql(q, state, reason,
+		state, types.MailingCampaignUserStateSent,
+		campaignID, botID, telegramID,
+	).Exec(); err != nil {
+		return fmt.Errorf("failed to update mailing campaign user state: %w", err)
+	}
+
+	return nil
+}
+
+// FinishMailingCampaign closes the campaign and releases its leases, so users which were leased
+// but never reported back return to the ready state.
+func (c *Client) FinishMailingCampaign(id int) error {
+	sess := c.GetSession()
+
+	q := `update mailing_campaigns
+	set state       = ?,
+		finished_at = now(),
+		updated_at  = now()
+	where id = ?
+	  and state = ?`
+	if _, err := sess.UpdateBySql(q,
+		types.MailingCampaignStateFinished,
+		id,
+		types.MailingCampaignStateActive,
+	).Exec(); err != nil {
+		return fmt.Errorf("failed to finish mailing campaign: %w", err)
+	}
+
+	if _, err := c.releaseMailingLeases(types.MailingLeaseStateReleased, "campaign_id = ?", id); err != nil {
+		return fmt.Errorf("failed to release mailing campaign users: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectMailingCampaignsStats(ids []int) (map[int]*types.MailingCampaignStats, error) {
+	sess := c.GetSession()
+
+	res := make(map[int]*types.MailingCampaignStats, len(ids))
+	if len(ids) == 0 {
+		return res, nil
+	}
+
+	stats := make([]*types.MailingCampaignStats, 0)
+
+	q := `
+		select campaign_id,
+			   coalesce(sum(case when state = ? then 1 end), 0) as leased,
+			   coalesce(sum(case when state = ? then 1 end), 0) as sent,
+			   coalesce(sum(case when state = ? then 1 end), 0) as blocked,
+			   coalesce(sum(case when state = ? then 1 end), 0) as failed,
+			   count(*)                                         as total
+		from mailing_campaign_users
+		where campaign_id in ?
+		group by campaign_id
+	`
+	if _, err := sess.SelectBySql(q,
+		types.MailingCampaignUserStateLeased,
+		types.MailingCampaignUserStateSent,
+		types.MailingCampaignUserStateBlocked,
+		types.MailingCampaignUserStateFailed,
+		ids,
+	).Load(&stats); err != nil {
+		return nil, fmt.Errorf("failed to select mailing campaigns stats: %w", err)
+	}
+
+	for _, stat := range stats {
+		if processed := stat.Sent + stat.Blocked + stat.Failed; processed > 0 {
+			stat.DeliveryRate = float64(stat.Sent) / float64(processed) * 100
+		}
+
+		res[stat.CampaignID] = stat
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectBotMailingPolicy(botID int) (*types.MailingPolicy, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.MailingPolicy, 0)
+
+	q := `select * from mailing_policies where bot_id = ?`
+	if _, err := sess.SelectBySql(q, botID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select bot mailing policy: %w", err)
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res[0], nil
+}
+
+func (c *Client) UpsertMailingPolicy(policy *types.MailingPolicy) error {
+	sess := c.GetSession()
+
+	q := `insert into mailing_policies (bot_id, max_per_second, max_per_minute,
+										quiet_hours_start, quiet_hours_end, default_timezone, min_gap)
+		  values (?, ?, ?, ?, ?, ?, ?)
+		  on conflict (bot_id) do update set max_per_second    = excluded.max_per_second,
+											 max_per_minute    = excluded.max_per_minute,
+											 quiet_hours_start = excluded.quiet_hours_start,
+											 quiet_hours_end   = excluded.quiet_hours_end,
+											 default_timezone  = excluded.default_timezone,
+											 min_gap           = excluded.min_gap,
+											 updated_at        = now()
+		  returning *`
+	if err := sess.SelectBySql(q,
+		policy.BotID,
+		policy.MaxPerSecond,
+		policy.MaxPerMinute,
+		policy.QuietHoursStart,
+		policy.QuietHoursEnd,
+		policy.DefaultTimezone,
+		policy.MinGap,
+	).LoadOne(policy); err != nil {
+		return fmt.Errorf("failed to upsert mailing policy: %w", err)
+	}
+
+	return nil
+}
+
+// CountBotLeasedUsersSince returns how many users were leased for the bot during the last seconds.
+func (c *Client) CountBotLeasedUsersSince(botID int, seconds int) (int, error) {
+	return countBotLeasedUsersSince(c.GetSession(), botID, seconds)
+}
+
+func countBotLeasedUsersSince(r dbr.SessionRunner, botID int, seconds int) (int, error) {
+	var count int
+
+	q := `select coalesce(sum(users), 0) from mailing_leases where bot_id = ? and created_at > now() - ? * interval '1 second'`
+	if _, err := r.SelectBySql(q, botID, seconds).Load(&count); err != nil {
+		return 0, fmt.Errorf("failed to count bot leased users: %w", err)
+	}
+
+	return count, nil
+}
+
+// beginMailingLease opens the lease transaction and creates the lease with the batch size capped
+// by the rate windows. The bot is locked until the transaction ends, so concurrent leases count each other.
+func (c *Client) beginMailingLease(lease *types.MailingLease, ttl time.Duration, windows []types.MailingRateWindow, limit int) (*dbr.Tx, int, error) {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to begin mailing lease transaction: %w", err)
+	}
+
+	if _, err := tx.Exec(`select pg_advisory_xact_lock($1)`, lease.BotID); err != nil {
+		tx.Rollback()
+		return nil, 0, fmt.Errorf("failed to lock bot mailing leases: %w", err)
+	}
+
+	limit, err = types.CapMailingLimit(limit, windows, func(seconds int) (int, error) {
+		return countBotLeasedUsersSince(tx, lease.BotID, seconds)
+	})
+	if err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	if err := createMailingLease(tx, lease, ttl); err != nil {
+		tx.Rollback()
+		return nil, 0, err
+	}
+
+	return tx, limit, nil
+}
+
+func createMailingLease(r dbr.SessionRunner, lease *types.MailingLease, ttl time.Duration) error {
+	q := `insert into mailing_leases (lease_id, bot_id, depot_channel_hash, campaign_id, expires_at)
+		  values (?, ?, ?, ?, now() + ? * interval '1 second')
+		  returning *`
+	if err := r.SelectBySql(q,
+		lease.LeaseID,
+		lease.BotID,
+		lease.DepotChannelHash,
+		lease.CampaignID,
+		int(ttl.Seconds()),
+	).LoadOne(lease); err != nil {
+		return fmt.Errorf("failed to create mailing lease: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectMailingLease(leaseID uuid.UUID) (*types.MailingLease, error) {
+	sess := c.GetSession()
+
+	res := &types.MailingLease{}
+
+	q := `select * from mailing_leases where lease_id = ?`
+	if err := sess.SelectBySql(q, leaseID).LoadOne(res); err != nil {
+		if errors.Is(err, dbr.ErrNotFound) {
+			return nil, ErrMailingLeaseNotFound
+		}
+		return nil, fmt.Errorf("failed to select mailing lease: %w", err)
+	}
+
+	return res, nil
+}
+
+// HasActiveMailingLeases reports whether users of the channel are leased by a sender right now.
+func (c *Client) HasActiveMailingLeases(botID int, depotChannelHash string) (bool, error) {
+	sess := c.GetSession()
+
+	var exists bool
+
+	q := `select exists (select 1
+						 from mailing_leases
+						 where bot_id = ?
+						   and depot_channel_hash = ?
+						   and state = ?
+						   and expires_at > now())`
+	if _, err := sess.SelectBySql(q, botID, depotChannelHash, types.MailingLeaseStateActive).Load(&exists); err != nil {
+		return false, fmt.Errorf("failed to check active mailing leases: %w", err)
+	}
+
+	return exists, nil
+}
+
+// LeaseReadyUsersByDepotChannelHash creates the lease capped by the rate windows and moves random ready users
+// of the channel to in-progress under it. Rows locked by concurrent leases are skipped, so parallel senders
+// never receive the same user.
+func (c *Client) LeaseReadyUsersByDepotChannelHash(lease *types.MailingLease, ttl time.Duration, windows []types.MailingRateWindow, filter *types.MailingSegmentFilter, limit int) ([]*types.User, error) {
+	tx, limit, err := c.beginMailingLease(lease, ttl, windows, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	res := make([]*types.User, 0)
+
+	cond, args := segmentCondition(filter)
+
+	q := `
+		with leased as (select id
+						from users
+						where mailing_state = ?
+						  and bot_id = ?
+						  and depot_channel_hash = ?` + notErasedCondition + cond + `
+						order by random()
+						limit ? for update skip locked)
+		update users
+		set mailing_state            = ?,
+			mailing_lease_id         = ?,
+			mailing_state_updated_at = now()
+		where id in (select id from leased)
+		returning users.*
+	`
+	params := []interface{}{
+		types.UserMailingStateReady,
+		lease.BotID,
+		lease.DepotChannelHash,
+	}
+	params = append(params, args...)
+	params = append(params,
+		limit,
+		types.UserMailingStateInProgress,
+		lease.LeaseID,
+	)
+
+	if _, err := tx.SelectBySql(q, params...).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to lease ready users: %w", err)
+	}
+
+	if err := updateMailingLeaseUsers(tx, lease, len(res)); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit mailing lease transaction: %w", err)
+	}
+
+	return res, nil
+}
+
+func updateMailingLeaseUsers(r dbr.SessionRunner, lease *types.MailingLease, users int) error {
+	q := `update mailing_leases set users = ?, updated_at = now() where lease_id = ?`
+	if _, err := r.UpdateBySql(q, users, lease.LeaseID).Exec(); err != nil {
+		return fmt.Errorf("failed to update mailing lease users: %w", err)
+	}
+
+	lease.Users = users
+
+	return nil
+}
+
+// ReleaseMailingLease returns users of the lease which are still in-progress back to ready.
+func (c *Client) ReleaseMailingLease(leaseID uuid.UUID) (int, error) {
+	return c.releaseMailingLeases(types.MailingLeaseStateReleased, "lease_id = ?", leaseID)
+}
+
+// ExpireMailingLeases returns users of all overdue leases which are still in-progress back to ready.
+func (c *Client) ExpireMailingLeases() (int, error) {
+	return c.releaseMailingLeases(types.MailingLeaseStateExpired, "expires_at < now()")
+}
+
+func (c *Client) releaseMailingLeases(state, cond string, args ...interface{}) (int, error) {
+	sess := c.GetSession()
+
+	var count int
+
+	q := `
+		with closed as (update mailing_leases
+						set state      = ?,
+							updated_at = now()
+						where state = ?
+						  and ` + cond + `
+						returning lease_id, campaign_id),
+			 released as (update users
+						  set mailing_state            = ?,
+							  mailing_lease_id         = ?,
+							  mailing_state_updated_at = now()
+						  from closed
+						  where users.mailing_lease_id = closed.lease_id
+							and users.mailing_state = ?
+						  returning users.id, closed.campaign_id),
+			 detached as (delete
+						  from mailing_campaign_users mcu
+							  using released
+						  where mcu.user_id = released.id
+							and mcu.campaign_id = released.campaign_id
+							and mcu.state = ?)
+		select count(*)
+		from released
+	`
+
+	params := []interface{}{state, types.MailingLeaseStateActive}
+	params = append(params, args...)
+	params = append(params,
+		types.UserMailingStateReady,
+		uuid.Nil,
+		types.UserMailingStateInProgress,
+		types.MailingCampaignUserStateLeased,
+	)
+
+	if _, err := sess.SelectBySql(q, params...).Load(&count); err != nil {
+		return 0, fmt.Errorf("failed to release mailing leases: %w", err)
+	}
+
+	return count, nil
+}
+
+func (c *Client) CreateMailingDelivery(delivery *types.MailingDelivery) error {
+	sess := c.GetSession()
+
+	if err := sess.InsertInto("mailing_deliveries").
+		Columns(
+			"bot_id",
+			"user_id",
+			"campaign_id",
+			"event",
+			"reason",
+			"permanent",
+		).
+		Record(delivery).
+		Returning("id", "created_at").
+		Load(delivery); err != nil {
+		return fmt.Errorf("failed to create mailing delivery: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectUserMailingDeliveries(userID, limit int) ([]*types.MailingDelivery, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.MailingDelivery, 0)
+
+	q := `select * from mailing_deliveries where user_id = ? order by id desc limit ?`
+	if _, err := sess.SelectBySql(q, userID, limit).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select user mailing deliveries: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectBotMailingBlocksByPeriod(botID int, period string, start, end time.Time) ([]*types.MailingBlocksRow, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.MailingBlocksRow, 0)
+
+	q := `
+		select coalesce(sum(case when event = ? then 1 end), 0) as sent,
+			   coalesce(sum(case when event = ? then 1 end), 0) as failed,
+			   coalesce(sum(case when event = ? then 1 end), 0) as blocked,
+			   coalesce(sum(case when event = ? then 1 end), 0) as unblocked,
+			   date_trunc(?, created_at)                        as by_period
+		from mailing_deliveries
+		where bot_id = ?
+		  and (date(created_at) > date(?) and date(created_at) <= date(?))
+		group by by_period
+		order by by_period desc
+	`
+	if _, err := sess.SelectBySql(q,
+		types.MailingDeliveryEventSent,
+		types.MailingDeliveryEventFailed,
+		types.MailingDeliveryEventBlocked,
+		types.MailingDeliveryEventUnblocked,
+		period,
+		botID,
+		start,
+		end,
+	).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select bot mailing blocks: %w", err)
+	}
+
+	for _, row := range res {
+		if attempts := row.Sent + row.Failed + row.Blocked; attempts > 0 {
+			row.BlockRate = float64(row.Blocked) / float64(attempts) * 100
+		}
+
+		if row.Blocked > 0 {
+			row.UnblockRate = float64(row.Unblocked) / float64(row.Blocked) * 100
+		}
+
+		row.ByPeriod = row.ByPeriodDB.Format(time.DateOnly)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectMailingCampaignVariants(campaignID int) ([]*types.MailingCampaignVariant, error) {
+	return selectMailingCampaignVariants(c.GetSession(), campaignID)
+}
+
+func selectMailingCampaignVariants(r dbr.SessionRunner, campaignID int) ([]*types.MailingCampaignVariant, error) {
+	res := make([]*types.MailingCampaignVariant, 0)
+
+	q := `select * from mailing_campaign_variants where campaign_id = ? order by id`
+	if _, err := r.SelectBySql(q, campaignID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select mailing campaign variants: %w", err)
+	}
+
+	return res, nil
+}
+
+// assignMailingCampaignVariants picks a variant for every leased campaign user and stores the assignment,
+// returns the variants by telegram id or nil for campaigns without variants.
+func assignMailingCampaignVariants(r dbr.SessionRunner, campaignID int, users []*types.User) (map[int64]*types.MailingCampaignVariant, error) {
+	variants, err := selectMailingCampaignVariants(r, campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(variants) == 0 {
+		return nil, nil
+	}
+
+	res := make(map[int64]*types.MailingCampaignVariant, len(users))
+	assignments := make(map[int][]int, len(variants))
+	for _, user := range users {
+		variant := types.PickMailingCampaignVariant(variants, campaignID, user.ID)
+		if variant == nil {
+			continue
+		}
+
+		res[user.TelegramID] = variant
+		assignments[variant.ID] = append(assignments[variant.ID], user.ID)
+	}
+
+	for variantID, userIDs := range assignments {
+		q := `update mailing_campaign_users set variant_id = ? where campaign_id = ? and user_id in ?`
+		if _, err := r.UpdateBySql(q, variantID, campaignID, userIDs).Exec(); err != nil {
+			return nil, fmt.Errorf("failed to assign mailing campaign variants: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
+// SelectMailingCampaignVariantsStats compares campaign variants by delivery and by what users did
+// within the attribution window after the message was sent. Messages are taken from users.messaged_at,
+// so only the last message of the user is considered.
+func (c *Client) SelectMailingCampaignVariantsStats(campaignID int, window time.Duration) ([]*types.MailingCampaignVariantStats, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.MailingCampaignVariantStats, 0)
+
+	q := `
+		with cu as (select mcu.variant_id,
+						   mcu.user_id,
+						   mcu.state,
+						   mcu.sent_at,
+						   mcu.sent_at + ? * interval '1 second'            as window_end
+					from mailing_campaign_users mcu
+					where mcu.campaign_id = ?)
+		select cu.variant_id,
+			   count(*)                                                 as total,
+			   coalesce(sum(case when cu.state = ? then 1 end), 0)      as sent,
+			   coalesce(sum(case when cu.state = ? then 1 end), 0)      as blocked,
+			   coalesce(sum(case when cu.state = ? then 1 end), 0)      as failed,
+			   coalesce(sum(case
+								when cu.state = ?
+									and u.messaged_at > cu.sent_at
+									and u.messaged_at <= cu.window_end then 1 end), 0) as messaged,
+			   coalesce(sum(case
+								when cu.state = ? and exists (select 1
+															 from events_log el
+															 where el.user_id = cu.user_id
+															   and el.event_type = ?
+															   and el.created_at > cu.sent_at
+															   and el.created_at <= cu.window_end) then 1 end), 0) as launched,
+			   coalesce(sum(case
+								when cu.state = ? and exists (select 1
+															 from events_log el
+															 where el.user_id = cu.user_id
+															   and el.event_type = ?
+															   and el.created_at > cu.sent_at
+															   and el.created_at <= cu.window_end) then 1 end), 0) as deposited,
+			   coalesce(sum(case
+								when cu.state = ? then (select sum(t.price * t.amount)
+														from transactions t
+														where t.user_id = cu.user_id
+														  and t.created_at > cu.sent_at
+														  and t.created_at <= cu.window_end) end), 0) as income
+		from cu
+				 join users u on u.id = cu.user_id
+		group by cu.variant_id
+		order by cu.variant_id
+	`
+	if _, err := sess.SelectBySql(q,
+		int(window.Seconds()),
+		campaignID,
+		types.MailingCampaignUserStateSent,
+		types.MailingCampaignUserStateBlocked,
+		types.MailingCampaignUserStateFailed,
+		types.MailingCampaignUserStateSent,
+		types.MailingCampaignUserStateSent, types.EventTypeLaunch,
+		types.MailingCampaignUserStateSent, types.EventTypeDeposit,
+		types.MailingCampaignUserStateSent,
+	).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select mailing campaign variants stats: %w", err)
+	}
+
+	for _, stat := range res {
+		if processed := stat.Sent + stat.Blocked + stat.Failed; processed > 0 {
+			stat.DeliveryRate = float64(stat.Sent) / float64(processed) * 100
+		}
+
+		if stat.Sent > 0 {
+			stat.MessageRate = float64(stat.Messaged) / float64(stat.Sent) * 100
+			stat.LaunchRate = float64(stat.Launched) / float64(stat.Sent) * 100
+			stat.ConversionRate = float64(stat.Deposited) / float64(stat.Sent) * 100
+		}
+	}
+
+	return res, nil
+}
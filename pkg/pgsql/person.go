@@ -0,0 +1,102 @@
+package pgsql
+
+import (
+	"fmt"
+
+	"github.com/gocraft/dbr/v2"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// uniquePersonCondition matches users table rows which are the first user of their person.
+const uniquePersonCondition = `exists (select 1 from persons p where p.first_user_id = users.id)`
+
+// upsertPersons recalculates the persons of the telegram ids from their user rows.
+func upsertPersons(r dbr.SessionRunner, telegramIDs []int64) error {
+	if len(telegramIDs) == 0 {
+		return nil
+	}
+
+	q := `insert into persons (telegram_id, first_user_id, first_bot_id, bots, first_seen_at, last_joined_at)
+		  select telegram_id,
+				 (array_agg(id order by created_at, id))[1],
+				 (array_agg(bot_id order by created_at, id))[1],
+				 count(distinct bot_id),
+				 min(created_at),
+				 max(created_at)
+		  from users
+		  where telegram_id in ?
+		  group by telegram_id
+		  on conflict (telegram_id) do update set first_user_id  = excluded.first_user_id,
+												  first_bot_id   = excluded.first_bot_id,
+												  bots           = excluded.bots,
+												  first_seen_at  = excluded.first_seen_at,
+												  last_joined_at = excluded.last_joined_at,
+												  updated_at     = now()`
+	if _, err := r.InsertBySql(q, telegramIDs).Exec(); err != nil {
+		return fmt.Errorf("failed to upsert persons: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectPersonByTelegramID(telegramID int64) (*types.Person, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.Person, 0)
+
+	q := `select * from persons where telegram_id = ?`
+	if _, err := sess.SelectBySql(q, telegramID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select person: %w", err)
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res[0], nil
+}
+
+// SelectPersonTimeline returns the joins, deeplink touches, logged events and transactions
+// of the person in all bots ordered by time.
+func (c *Client) SelectPersonTimeline(telegramID int64, limit int) ([]*types.PersonTimelineEntry, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.PersonTimelineEntry, 0)
+
+	q := `select tl.at, tl.event, tl.bot_id, tl.user_id, b.trace_uuid, tl.details
+		  from (select u.created_at as at, ? as event, u.bot_id, u.id as user_id, coalesce(d.label, '') as details
+				from users u
+						 left join deeplinks d on d.id = u.deeplink_id
+				where u.telegram_id = ?
+				union all
+				select t.created_at, ?, u.bot_id, u.id, d.label
+				from deeplink_touches t
+						 join users u on u.id = t.user_id
+						 join deeplinks d on d.id = t.deeplink_id
+				where u.telegram_id = ?
+				union all
+				select el.created_at, el.event_type, u.bot_id, u.id, ''
+				from events_log el
+						 join users u on u.id = el.user_id
+				where u.telegram_id = ?
+				union all
+				select tr.created_at, ?, u.bot_id, u.id, tr.blockchain
+				from transactions tr
+						 join users u on u.id = tr.user_id
+				where u.telegram_id = ?) tl
+				   join bots b on b.id = tl.bot_id
+		  order by tl.at desc, tl.user_id
+		  limit ?`
+	if _, err := sess.SelectBySql(q,
+		types.PersonTimelineEventJoined, telegramID,
+		types.PersonTimelineEventDeeplink, telegramID,
+		telegramID,
+		types.PersonTimelineEventTransaction, telegramID,
+		limit,
+	).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select person timeline: %w", err)
+	}
+
+	return res, nil
+}
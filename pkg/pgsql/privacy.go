@@ -0,0 +1,124 @@
+package pgsql
+
+import (
+	"fmt"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+func (c *Client) SelectDeeplinksByReferralTelegramID(telegramID int64) ([]*types.Deeplink, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.Deeplink, 0)
+
+	q := `select * from deeplinks where referral_telegram_id = ? order by id`
+	if _, err := sess.SelectBySql(q, telegramID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select deeplinks by referral telegram id: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectUserMailingCampaignUsers(userID int) ([]*types.MailingCampaignUser, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.MailingCampaignUser, 0)
+
+	q := `select * from mailing_campaign_users where user_id = ? order by id`
+	if _, err := sess.SelectBySql(q, userID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select user mailing campaign users: %w", err)
+	}
+
+	return res, nil
+}
+
+// notErasedCondition excludes erased users from mailing, their mailing state is kept as is.
+const notErasedCondition = ` and users.erased_at = '1970-01-01 00:00:00'`
+
+// ErasePerson anonymises the personal fields of every user of the telegram id and replaces the telegram id
+// with the negated person id everywhere, so the rows keep counting in reports but can't be linked back.
+// Returns the pseudonym and the number of erased users.
+func (c *Client) ErasePerson(telegramID int64) (int64, int, error) {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin erase transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	persons := make([]int, 0)
+
+	q := `select id from persons where telegram_id = ? for update`
+	if _, err := tx.SelectBySql(q, telegramID).Load(&persons); err != nil {
+		return 0, 0, fmt.Errorf("failed to select person: %w", err)
+	}
+
+	if len(persons) == 0 {
+		return 0, 0, ErrPersonNotFound
+	}
+
+	pseudonym := -int64(persons[0])
+
+	q = `update users
+		 set first_name          = '',
+			 last_name           = '',
+			 username            = '',
+			 forward_sender_name = '',
+			 ip                  = '',
+			 user_agent          = '',
+			 telegram_id         = ?,
+			 erased_at           = now(),
+			 updated_at          = now()
+		 where telegram_id = ?`
+	res, err := tx.UpdateBySql(q, pseudonym, telegramID).Exec()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to erase users: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	q = `update persons set telegram_id = ?, updated_at = now() where id = ?`
+	if _, err := tx.UpdateBySql(q, pseudonym, persons[0]).Exec(); err != nil {
+		return 0, 0, fmt.Errorf("failed to erase person: %w", err)
+	}
+
+	q = `update pixel_links
+		 set fbc = '',
+			 fbp = ''
+		 where invite_uuid in (select invite_uuid
+							   from users
+							   where telegram_id = ?
+								 and invite_uuid <> '00000000-0000-0000-0000-000000000000')`
+	if _, err := tx.UpdateBySql(q, pseudonym).Exec(); err != nil {
+		return 0, 0, fmt.Errorf("failed to erase pixel links: %w", err)
+	}
+
+	q = `update deeplinks set referral_telegram_id = ?, updated_at = now() where referral_telegram_id = ?`
+	if _, err := tx.UpdateBySql(q, pseudonym, telegramID).Exec(); err != nil {
+		return 0, 0, fmt.Errorf("failed to erase referral deeplinks: %w", err)
+	}
+
+	q = `update events_log
+		 set reporter_telegram_id = case when reporter_telegram_id = ? then ? else reporter_telegram_id end,
+			 telegram_id          = case when telegram_id = ? then ? else telegram_id end,
+			 updated_at           = now()
+		 where reporter_telegram_id = ?
+			or telegram_id = ?`
+	if _, err := tx.UpdateBySql(q,
+		telegramID, pseudonym,
+		telegramID, pseudonym,
+		telegramID, telegramID,
+	).Exec(); err != nil {
+		return 0, 0, fmt.Errorf("failed to erase events log: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit erase transaction: %w", err)
+	}
+
+	return pseudonym, int(affected), nil
+}
@@ -8,29 +8,33 @@ import (
 
 const DateFormatDay = "2006-01-02"
 
-func (c *Client) SelectLeadsByCampaign(token string, start, end time.Time) ([]*types.LeadsByCampaignRow, error) {
+func (c *Client) SelectLeadsByCampaign(botID int, groupBy, model string, start, end time.Time) ([]*types.LeadsByCampaignRow, error) {
 	sess := c.GetSession()
 
 	res := make([]*types.LeadsByCampaignRow, 0)
 
-	q := `SELECT d.label,
-       count(*)                                         AS users_total,
-       sum(case when users.seen < 1 then 1 else 0 end)  as users_unique,
-       sum(case when users.deposited then 1 else 0 end) as users_deposited,
-       sum(users.deposits_sum)                          as deposits_sum,
-       sum(users.deposits_total)                        as deposits_total
+	attribution, args := deeplinkAttributionCTE(botID, model)
+	join, group := deeplinkGroup(groupBy)
+
+	q := `WITH ` + attribution + `
+SELECT ` + group + ` AS label,
+       round(sum(ua.weight))::int                                               AS users_total,
+       round(sum(case when ` + uniquePersonCondition + ` then ua.weight else 0 end))::int as users_unique,
+       round(sum(case when users.deposited then ua.weight else 0 end))::int     as users_deposited,
+       sum(users.deposits_sum * ua.weight)                                      as deposits_sum,
+       round(sum(users.deposits_total * ua.weight))::int                        as deposits_total
 FROM users
-         JOIN bots b ON b.id = users.bot_id
-         JOIN deeplinks d ON d.id = users.deeplink_id
-WHERE b.bot_token = ?
+         JOIN user_attribution ua ON ua.user_id = users.id
+         JOIN deeplinks d ON d.id = ua.deeplink_id` + join + `
+WHERE users.bot_id = ?
   AND date_trunc('day', users.created_at) BETWEEN date ?
     AND date ?
-GROUP BY d.label
+GROUP BY ` + group + `
 order by users_total desc;
 `
-	if _, err := sess.SelectBySql(q, token,
+	if _, err := sess.SelectBySql(q, append(args, botID,
 		start.Format(DateFormatDay),
-		end.Format(DateFormatDay)).Load(&res); err != nil {
+		end.Format(DateFormatDay))...).Load(&res); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,173 @@
+package pgsql
+
+import (
+	"fmt"
+	"time"
+)
+
+// retentionBatchSize bounds the id range removed by a single retention delete,
+// so the first run over a long untouched table doesn't hold the locks for its whole length.
+const retentionBatchSize = 10000
+
+// DownsamplePrices keeps the latest price of every ticker per hour for prices older than the cutoff.
+// Returns the number of deleted rows, nothing is deleted in the dry run.
+func (c *Client) DownsamplePrices(cutoff time.Time, dryRun bool) (int, error) {
+	cond := `created_at < ?
+			 and exists(select 1
+						from prices newer
+						where newer.ticker = prices.ticker
+						  and newer.created_at < ?
+						  and date_trunc('hour', newer.created_at) = date_trunc('hour', prices.created_at)
+						  and newer.id > prices.id)`
+
+	if dryRun {
+		return c.countRows("prices", cond, cutoff, cutoff)
+	}
+
+	deleted, err := c.deleteInBatches("prices", cond, cutoff, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to downsample prices: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// RollupSnapshots replaces snapshots of the whole hours before the cutoff with a single hourly snapshot
+// of the average users, hours which are already rolled up are skipped. Returns the number of removed raw rows.
+func (c *Client) RollupSnapshots(cutoff time.Time, dryRun bool) (int, error) {
+	sess := c.GetSession()
+
+	res := make([]int, 0)
+
+	q, args := rollupSnapshotsQuery(cutoff, dryRun)
+	if _, err := sess.SelectBySql(q, args...).Load(&res); err != nil {
+		return 0, fmt.Errorf("failed to rollup snapshots: %w", err)
+	}
+
+	if len(res) == 0 {
+		return 0, nil
+	}
+
+	return res[0], nil
+}
+
+// rollupSnapshotsQuery renders the snapshots rollup returning the number of removed raw rows,
+// the dry run only counts them.
+func rollupSnapshotsQuery(cutoff time.Time, dryRun bool) (string, []interface{}) {
+	// a partially covered hour would be averaged again with the rows arriving later,
+	// so only whole hours before the cutoff are rolled up
+	cutoff = cutoff.Truncate(time.Hour)
+
+	hours := `select bot_id, snapshot, date_trunc('hour', created_at) as hour, count(*) as raw
+			  from snapshots
+			  where created_at < ?
+			  group by bot_id, snapshot, date_trunc('hour', created_at)
+			  having count(*) > 1`
+
+	if dryRun {
+		return `select coalesce(sum(raw - 1), 0) from (` + hours + `) h`, []interface{}{cutoff}
+	}
+
+	q := `with hours as (` + hours + `),
+			   deleted as (delete from snapshots s
+						   using hours h
+						   where s.bot_id = h.bot_id
+							 and s.snapshot = h.snapshot
+							 and date_trunc('hour', s.created_at) = h.hour
+						   returning s.bot_id, s.snapshot, s.users, h.hour),
+			   inserted as (insert into snapshots (bot_id, snapshot, users, created_at)
+							select bot_id, snapshot, round(avg(users))::int, hour
+							from deleted
+							group by bot_id, snapshot, hour
+							returning id)
+		  select (select count(*) from deleted) - (select count(*) from inserted)`
+
+	return q, []interface{}{cutoff}
+}
+
+// DeleteOlderThan purges the table rows whose column is before the cutoff.
+// Returns the number of deleted rows, nothing is deleted in the dry run.
+func (c *Client) DeleteOlderThan(table, column string, cutoff time.Time, dryRun bool) (int, error) {
+	cond := column + ` < ?`
+
+	if dryRun {
+		return c.countRows(table, cond, cutoff)
+	}
+
+	deleted, err := c.deleteInBatches(table, cond, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s: %w", table, err)
+	}
+
+	return deleted, nil
+}
+
+// deleteInBatches deletes the table rows matching the condition in retentionBatchSize id ranges,
+// each range is deleted by a separate statement.
+func (c *Client) deleteInBatches(table, cond string, args ...interface{}) (int, error) {
+	sess := c.GetSession()
+
+	bounds := struct {
+		MinID int `db:"min_id"`
+		MaxID int `db:"max_id"`
+	}{}
+
+	q := `select coalesce(min(id), 0) as min_id, coalesce(max(id), 0) as max_id from ` + table + ` where ` + cond
+	if _, err := sess.SelectBySql(q, args...).Load(&bounds); err != nil {
+		return 0, err
+	}
+
+	if bounds.MaxID == 0 {
+		return 0, nil
+	}
+
+	return deleteIDRanges(bounds.MinID, bounds.MaxID, retentionBatchSize, func(from, to int) (int, error) {
+		batchArgs := append([]interface{}{from, to}, args...)
+
+		res, err := sess.DeleteBySql(`delete from `+table+` where id >= ? and id < ? and `+cond, batchArgs...).Exec()
+		if err != nil {
+			return 0, err
+		}
+
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+
+		return int(affected), nil
+	})
+}
+
+// deleteIDRanges calls del for the consecutive [from, to) ranges of the batch size covering minID..maxID
+// and sums the deleted rows, stopping at the first error.
+func deleteIDRanges(minID, maxID, batch int, del func(from, to int) (int, error)) (int, error) {
+	deleted := 0
+
+	for from := minID; from <= maxID; from += batch {
+		n, err := del(from, from+batch)
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted += n
+	}
+
+	return deleted, nil
+}
+
+func (c *Client) countRows(table, cond string, args ...interface{}) (int, error) {
+	sess := c.GetSession()
+
+	res := make([]int, 0)
+
+	q := `select count(*) from ` + table + ` where ` + cond
+	if _, err := sess.SelectBySql(q, args...).Load(&res); err != nil {
+		return 0, fmt.Errorf("failed to count %s rows: %w", table, err)
+	}
+
+	if len(res) == 0 {
+		return 0, nil
+	}
+
+	return res[0], nil
+}
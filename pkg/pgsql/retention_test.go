@@ -0,0 +1,52 @@
+package pgsql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeleteIDRanges(t *testing.T) {
+	seen := make(map[int]int)
+
+	deleted, err := deleteIDRanges(3, 25, 10, func(from, to int) (int, error) {
+		for id := from; id < to; id++ {
+			seen[id]++
+		}
+
+		return to - from, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id := 3; id <= 25; id++ {
+		if seen[id] != 1 {
+			t.Errorf("id %d covered %d times", id, seen[id])
+		}
+	}
+
+	if deleted != 30 {
+		t.Errorf("deleted = %d, want 30", deleted)
+	}
+}
+
+func TestDeleteIDRangesStopsOnError(t *testing.T) {
+	errDelete := errors.New("delete")
+	calls := 0
+
+	deleted, err := deleteIDRanges(1, 100, 10, func(from, to int) (int, error) {
+		calls++
+		if calls == 2 {
+			return 0, errDelete
+		}
+
+		return 5, nil
+	})
+	if !errors.Is(err, errDelete) {
+		t.Fatalf("err = %v, want %v", err, errDelete)
+	}
+
+	if calls != 2 || deleted != 5 {
+		t.Errorf("calls = %d, deleted = %d, want 2 and 5", calls, deleted)
+	}
+}
@@ -0,0 +1,185 @@
+package pgsql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+func (c *Client) UpsertMailingSegment(segment *types.MailingSegment) error {
+	sess := c.GetSession()
+
+	q := `insert into mailing_segments (bot_id, name, filter)
+		  values (?, ?, ?)
+		  on conflict (bot_id, name) do update set filter     = excluded.filter,
+												   updated_at = now()
+		  returning *`
+	if err := sess.SelectBySql(q, segment.BotID, segment.Name, segment.Filter).LoadOne(segment); err != nil {
+		return fmt.Errorf("failed to upsert mailing segment: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) SelectMailingSegment(id int) (*types.MailingSegment, error) {
+	sess := c.GetSession()
+
+	res := &types.MailingSegment{}
+
+	q := `select * from mailing_segments where id = ?`
+	if err := sess.SelectBySql(q, id).LoadOne(res); err != nil {
+		return nil, fmt.Errorf("failed to select mailing segment: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectBotMailingSegments(botID int) ([]*types.MailingSegment, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.MailingSegment, 0)
+
+	q := `select * from mailing_segments where bot_id = ? order by name`
+	if _, err := sess.SelectBySql(q, botID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select bot mailing segments: %w", err)
+	}
+
+	return res, nil
+}
+
+// DeleteMailingSegment removes the segment unless an active campaign still leases users by it.
+func (c *Client) DeleteMailingSegment(botID, id int) error {
+	sess := c.GetSession()
+
+	deleted := make([]int, 0)
+
+	q := `delete
+		  from mailing_segments
+		  where bot_id = ?
+			and id = ?
+			and not exists (select 1 from mailing_campaigns where segment_id = ? and state = ?)
+		  returning id`
+	if _, err := sess.SelectBySql(q, botID, id, id, types.MailingCampaignStateActive).Load(&deleted); err != nil {
+		return fmt.Errorf("failed to delete mailing segment: %w", err)
+	}
+
+	if len(deleted) > 0 {
+		return nil
+	}
+
+	segments := make([]int, 0)
+
+	q = `select id from mailing_segments where bot_id = ? and id = ?`
+	if _, err := sess.SelectBySql(q, botID, id).Load(&segments); err != nil {
+		return fmt.Errorf("failed to select mailing segment: %w", err)
+	}
+
+	if len(segments) > 0 {
+		return ErrMailingSegmentInUse
+	}
+
+	return nil
+}
+
+func (c *Client) CountReadyUsersByDepotChannelHash(botID int, hash string, filter *types.MailingSegmentFilter) (int, error) {
+	sess := c.GetSession()
+
+	var count int
+
+	cond, args := segmentCondition(filter)
+
+	q := `select count(*) from users where mailing_state = ? and bot_id = ? and depot_channel_hash = ?` + notErasedCondition + cond
+	params := append([]interface{}{types.UserMailingStateReady, botID, hash}, args...)
+	if _, err := sess.SelectBySql(q, params...).Load(&count); err != nil {
+		return 0, fmt.Errorf("failed to count ready users: %w", err)
+	}
+
+	return count, nil
+}
+
+// segmentCondition renders the filter as additional conditions on the users table,
+// the result is meant to be appended to an existing where clause.
+func segmentCondition(f *types.MailingSegmentFilter) (string, []interface{}) {
+	if f == nil {
+		return "", nil
+	}
+
+	conds := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	add := func(cond string, arg interface{}) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+
+	if len(f.LanguageCodes) > 0 {
+		add("users.language_code in ?", f.LanguageCodes)
+	}
+
+	if len(f.CountryCodes) > 0 {
+		add("users.country_code in ?", f.CountryCodes)
+	}
+
+	if len(f.DeeplinkLabels) > 0 {
+		add("users.deeplink_id in (select id from deeplinks where deeplinks.bot_id = users.bot_id and label in ?)", f.DeeplinkLabels)
+	}
+
+	if f.IsPremium != nil {
+		add("users.is_premium = ?", *f.IsPremium)
+	}
+
+	if f.Deposited != nil {
+		add("users.deposited = ?", *f.Deposited)
+	}
+
+	if f.Subscribed != nil {
+		add("users.subscribed = ?", *f.Subscribed)
+	}
+
+	if f.CreatedFrom != nil {
+		add("users.created_at >= ?", *f.CreatedFrom)
+	}
+
+	if f.CreatedTo != nil {
+		add("users.created_at < ?", *f.CreatedTo)
+	}
+
+	if f.MessagedFrom != nil {
+		add("users.messaged_at >= ?", *f.MessagedFrom)
+	}
+
+	if f.MessagedTo != nil {
+		add("users.messaged_at < ?", *f.MessagedTo)
+	}
+
+	if f.SeenMin != nil {
+		add("users.seen >= ?", *f.SeenMin)
+	}
+
+	if f.SeenMax != nil {
+		add("users.seen <= ?", *f.SeenMax)
+	}
+
+	if len(f.ExcludedCountryCodes) > 0 {
+		add("users.country_code not in ?", f.ExcludedCountryCodes)
+	}
+
+	if f.AllowedCountryCodes != nil {
+		if len(f.AllowedCountryCodes) == 0 {
+			conds = append(conds, "false")
+		} else {
+			add("users.country_code in ?", f.AllowedCountryCodes)
+		}
+	}
+
+	if f.MailedBefore != nil {
+		add("users.mailed_at < ?", *f.MailedBefore)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " and " + strings.Join(conds, " and "), args
+}
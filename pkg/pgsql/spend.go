@@ -0,0 +1,194 @@
+package pgsql
+
+import (
+	"fmt"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// deeplinkSpendCTE renders the deeplink_spend common table expression with daily fbtool stats
+// attributed to the bot deeplinks. Explicit deeplink_fbtool_links mappings are used first,
+// labels without mappings fall back to matching fbtool account names, in that case the stats
+// are attributed to the oldest deeplink of the label so they are not counted once per deeplink.
+// Mapped stats are split between deeplinks by the link share. Expenses from other sources
+// are attributed by label to the oldest deeplink of the label as well.
+func deeplinkSpendCTE(botID int) (string, []interface{}) {
+	q := `deeplink_spend as (select dfl.deeplink_id,
+										fcs.date,
+										round(fcs.clicks * dfl.share / 100)::int      as clicks,
+										round(fcs.impressions * dfl.share / 100)::int as impressions,
+										fcs.spend * dfl.share / 100                   as spend
+								 from deeplink_fbtool_links dfl
+										  join deeplinks d on d.id = dfl.deeplink_id
+										  join fbtool_campaigns_stats fcs on fcs.fbtool_account_id = dfl.fbtool_account_id
+									 and (dfl.campaign_id = '' or fcs.campaign_id = dfl.campaign_id)
+								 where d.bot_id = ?
+								 union all
+								 select l.deeplink_id,
+										fcs.date,
+										fcs.clicks,
+										fcs.impressions,
+										fcs.spend
+								 from (select label, min(id) as deeplink_id
+									   from deeplinks d
+									   where d.bot_id = ?
+										 and not exists (select 1
+														 from deeplink_fbtool_links dfl
+																  join deeplinks ld on ld.id = dfl.deeplink_id
+														 where ld.bot_id = d.bot_id
+														   and ld.label = d.label)
+									   group by label) l
+										  join fbtool_accounts fa on fa.fbtool_account_name = l.label
+										  join fbtool_campaigns_stats fcs on fcs.fbtool_account_id = fa.fbtool_account_id
+								 where not exists (select 1
+												   from deeplink_fbtool_links dfl
+												   where dfl.fbtool_account_id = fa.fbtool_account_id)
+								 union all
+								 select l.deeplink_id,
+										e.date,
+										e.clicks,
+										e.impressions,
+										e.spend
+								 from expenses e
+										  join (select label, min(id) as deeplink_id
+												from deeplinks
+												where bot_id = ?
+												group by label) l on l.label = e.label
+								 where e.bot_id = ?)`
+
+	return q, []interface{}{botID, botID, botID, botID}
+}
+
+// deeplinkGroup returns the join and the expression grouping rows of the deeplinks table aliased as d,
+// deeplinks without tags are grouped under an empty tag.
+func deeplinkGroup(groupBy string) (string, string) {
+	switch groupBy {
+	case types.DeeplinkGroupBySource:
+		return "", "d.source"
+	case types.DeeplinkGroupByCampaign:
+		return "", "d.campaign"
+	case types.DeeplinkGroupByAdSet:
+		return "", "d.ad_set"
+	case types.DeeplinkGroupByCreative:
+		return "", "d.creative"
+	case types.DeeplinkGroupByBuyer:
+		return "", "d.buyer"
+	case types.DeeplinkGroupByTag:
+		return " cross join lateral unnest(case when cardinality(d.tags) = 0 then array['']::text[] else d.tags end) as tag(value)", "tag.value"
+	default:
+		return "", "d.label"
+	}
+}
+
+// UpsertDeeplinkFBToolLink creates the link or updates its share. The account row is locked
+// so concurrent links can't exceed 100 percent of the account spend in total.
+func (c *Client) UpsertDeeplinkFBToolLink(link *types.DeeplinkFBToolLink) error {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin deeplink fbtool link transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	ids := make([]int, 0)
+
+	q := `select id from fbtool_accounts where fbtool_account_id = ? for update`
+	if _, err := tx.SelectBySql(q, link.FBToolAccountID).Load(&ids); err != nil {
+		return fmt.Errorf("failed to lock fbtool account: %w", err)
+	}
+
+	if len(ids) == 0 {
+		return ErrFBToolAccountNotFound
+	}
+
+	var taken float64
+
+	q, args := fbtoolLinkSharesQuery(link.FBToolAccountID, link.CampaignID, link.DeeplinkID)
+	if _, err := tx.SelectBySql(q, args...).Load(&taken); err != nil {
+		return fmt.Errorf("failed to sum deeplink fbtool link shares: %w", err)
+	}
+
+	if taken+link.Share > 100 {
+		return &types.DeeplinkFBToolLinkShareError{
+			Remaining: 100 - taken,
+		}
+	}
+
+	q = `insert into deeplink_fbtool_links (deeplink_id, fbtool_account_id, campaign_id, share)
+		  values (?, ?, ?, ?)
+		  on conflict (deeplink_id, fbtool_account_id, campaign_id) do update set share = excluded.share
+		  returning *`
+	if err := tx.SelectBySql(q, link.DeeplinkID, link.FBToolAccountID, link.CampaignID, link.Share).LoadOne(link); err != nil {
+		return fmt.Errorf("failed to upsert deeplink fbtool link: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit deeplink fbtool link transaction: %w", err)
+	}
+
+	return nil
+}
+
+// fbtoolLinkSharesQuery sums the share of the account spend taken by the links of every bot
+// except the one being upserted. Whole-account links take their share of every campaign,
+// so a whole-account link is checked against the most shared campaign and a campaign link
+// against the whole-account links and the links of the same campaign.
+func fbtoolLinkSharesQuery(fbtoolAccountID int, campaignID string, deeplinkID int) (string, []interface{}) {
+	q := `with links as (select campaign_id, share
+					   from deeplink_fbtool_links
+					   where fbtool_account_id = ?
+						 and not (deeplink_id = ? and campaign_id = ?))
+		  select coalesce((select sum(share) from links where campaign_id = ''), 0) +
+				 coalesce((select max(campaign_share)
+						   from (select sum(share) as campaign_share
+								 from links
+								 where campaign_id != ''
+								   and (? = '' or campaign_id = ?)
+								 group by campaign_id) c), 0)`
+
+	return q, []interface{}{fbtoolAccountID, deeplinkID, campaignID, campaignID, campaignID}
+}
+
+func (c *Client) DeleteDeeplinkFBToolLink(botID, id int) error {
+	sess := c.GetSession()
+
+	q := `delete
+		  from deeplink_fbtool_links dfl
+			  using deeplinks d
+		  where d.id = dfl.deeplink_id
+			and d.bot_id = ?
+			and dfl.id = ?`
+	res, err := sess.DeleteBySql(q, botID, id).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to delete deeplink fbtool link: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrDeeplinkFBToolLinkNotFound
+	}
+
+	return nil
+}
+
+func (c *Client) SelectBotDeeplinkFBToolLinks(botID int) ([]*types.DeeplinkFBToolLink, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.DeeplinkFBToolLink, 0)
+
+	q := `select dfl.*
+		  from deeplink_fbtool_links dfl
+				   join deeplinks d on d.id = dfl.deeplink_id
+		  where d.bot_id = ?
+		  order by dfl.id`
+	if _, err := sess.SelectBySql(q, botID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select deeplink fbtool links: %w", err)
+	}
+
+	return res, nil
+}
@@ -63,7 +63,7 @@ func (c *Client) SelectBotUsersByDay(botID int, start, end time.Time) (map[strin
 	conversions := make([]*types.ConversionRow, 0)
 	q := `
 		with cte as (select count(*)                                        as users_total,
-							sum(case when users.seen < 1 then 1 else 0 end) as users_unique,
+							sum(case when ` + uniquePersonCondition + ` then 1 else 0 end) as users_unique,
 							date_trunc('day', users.created_at)             as by_day
              		 from users
              		 where bot_id = ?
@@ -93,7 +93,7 @@ func (c *Client) SelectBotUsersByPeriod(botID int, period string, start, end tim
 	conversions := make([]*types.ConversionRow, 0)
 	q := `
 		with cte as (select count(*)                                        as users_total,
-							sum(case when users.seen < 1 then 1 else 0 end) as users_unique,
+							sum(case when ` + uniquePersonCondition + ` then 1 else 0 end) as users_unique,
 						    date_trunc(?, users.created_at)            as by_period
 					 from users
 					 where bot_id = ?
@@ -117,27 +117,31 @@ func (c *Client) SelectBotUsersByPeriod(botID int, period string, start, end tim
 	return res, nil
 }
 
-func (c *Client) SelectBotUsersByDeeplinks(botID int, start, end time.Time) (map[string]*types.ConversionRow, error) {
+func (c *Client) SelectBotUsersByDeeplinks(botID int, groupBy, model string, start, end time.Time) (map[string]*types.ConversionRow, error) {
 	sess := c.GetSession()
 	res := make(map[string]*types.ConversionRow, 0)
 	conversions := make([]*types.ConversionRow, 0)
+	attribution, args := deeplinkAttributionCTE(botID, model)
+	join, group := deeplinkGroup(groupBy)
 	q := `
-		with cte as (select count(*)                                        as users_total,
-                    		sum(case when users.seen < 1 then 1 else 0 end) as users_unique,
-                    		d.label                                         as label
+		with ` + attribution + `,
+			 cte as (select round(sum(ua.weight))::int                                        as users_total,
+                    		round(sum(case when ` + uniquePersonCondition + ` then ua.weight else 0 end))::int as users_unique,
+                    		` + group + `                                                       as label
              		 from users
-                      		join deeplinks d on users.deeplink_id = d.id
+                      		join user_attribution ua on ua.user_id = users.id
+                      		join deeplinks d on ua.deeplink_id = d.id` + join + `
              		 where users.bot_id = ?
                		   and (users.created_at > ? and users.created_at <= ?)
-					 group by d.label
+					 group by ` + group + `
 					 order by users_total desc)
 		select users_total,
 			users_unique,
-			users_unique::float4 / users_total::float4 * 100 as users_unique_rate,
+			coalesce(users_unique::float4 / nullif(users_total, 0)::float4 * 100, 0) as users_unique_rate,
 			label
 		from cte
 	`
-	if _, err := sess.SelectBySql(q, botID, start, end).Load(&conversions); err != nil {
+	if _, err := sess.SelectBySql(q, append(args, botID, start, end)...).Load(&conversions); err != nil {
 		return nil, fmt.Errorf("SelectBotUsersByDeeplinks: %w", err)
 	}
 
@@ -148,23 +152,24 @@ func (c *Client) SelectBotUsersByDeeplinks(botID int, start, end time.Time) (map
 	return res, nil
 }
 
-func (c *Client) SelectBotExpensesByDeeplinks(botID int, start, end time.Time) (map[string]*types.ConversionRow, error) {
+func (c *Client) SelectBotExpensesByDeeplinks(botID int, groupBy string, start, end time.Time) (map[string]*types.ConversionRow, error) {
 	sess := c.GetSession()
 	res := make(map[string]*types.ConversionRow, 0)
 	conversions := make([]*types.ConversionRow, 0)
+	spend, args := deeplinkSpendCTE(botID)
+	join, group := deeplinkGroup(groupBy)
 	q := `
-		select sum(clicks)      as clicks,
-			   sum(impressions) as impressions,
-			   sum(spend)       as expense,
-			   label
-		from deeplinks d
-			   join fbtool_accounts fa on d.label = fa.fbtool_account_name
-			   join fbtool_campaigns_stats fcs on fa.fbtool_account_id = fcs.fbtool_account_id
-		where d.bot_id = ?
-		  and (date(fcs.date) > date(?) and date(fcs.date) <= date(?))
-		group by d.label
+		with ` + spend + `
+		select sum(ds.clicks)      as clicks,
+			   sum(ds.impressions) as impressions,
+			   sum(ds.spend)       as expense,
+			   ` + group + `       as label
+		from deeplink_spend ds
+			   join deeplinks d on d.id = ds.deeplink_id` + join + `
+		where (date(ds.date) > date(?) and date(ds.date) <= date(?))
+		group by ` + group + `
 	`
-	if _, err := sess.SelectBySql(q, botID, start, end).Load(&conversions); err != nil {
+	if _, err := sess.SelectBySql(q, append(args, start, end)...).Load(&conversions); err != nil {
 		return nil, fmt.Errorf("SelectBotExpensesByDeeplinks: %w", err)
 	}
 
@@ -175,32 +180,41 @@ func (c *Client) SelectBotExpensesByDeeplinks(botID int, start, end time.Time) (
 	return res, nil
 }
 
-func (c *Client) SelectBotLeadsByDeeplinks(botID int, start, end time.Time) (map[string]*types.ConversionRow, error) {
+func (c *Client) SelectBotLeadsByDeeplinks(botID int, groupBy, model string, start, end time.Time) (map[string]*types.ConversionRow, error) {
 	sess := c.GetSession()
 	res := make(map[string]*types.ConversionRow, 0)
 	conversions := make([]*types.ConversionRow, 0)
+	attribution, args := deeplinkAttributionCTE(botID, model)
+	join, group := deeplinkGroup(groupBy)
 
 	q := `
-		with cte as (select count(distinct telegram_id)          as leads_users,
-							count(*)                             as leads_total,
-							coalesce(sum(t.price * t.amount), 0) as income,
-							d.label
-             		 from users u
-                      		join deeplinks d on d.id = u.deeplink_id
-                      		full outer join transactions t on u.id = t.user_id
-					 where u.bot_id = ?
-					   and (date(u.deposited_at) > date(?) and date(u.deposited_at) <= date(?))
-					   and (date(t.created_at) > date(?) and date(t.created_at) <= date(?) or t.created_at is null)
-					   and deposited = true
-					 group by d.label)
+		with ` + attribution + `,
+			 leads as (select u.id                                as user_id,
+							  count(*)                            as leads_total,
+							  coalesce(sum(t.price * t.amount), 0) as income
+					   from users u
+								left join transactions t on u.id = t.user_id
+					   where u.bot_id = ?
+						 and (date(u.deposited_at) > date(?) and date(u.deposited_at) <= date(?))
+						 and (date(t.created_at) > date(?) and date(t.created_at) <= date(?) or t.created_at is null)
+						 and deposited = true
+					   group by u.id),
+			 cte as (select round(sum(ua.weight))::int                 as leads_users,
+							round(sum(l.leads_total * ua.weight))::int as leads_total,
+							sum(l.income * ua.weight)                  as income,
+							` + group + `                              as label
+             		 from leads l
+                      		join user_attribution ua on ua.user_id = l.user_id
+                      		join deeplinks d on d.id = ua.deeplink_id` + join + `
+					 group by ` + group + `)
 		select leads_users,
 			   leads_total,
-			   leads_total::float4 / leads_users::float4 as leads_per_user,
+			   coalesce(leads_total::float4 / nullif(leads_users, 0)::float4, 0) as leads_per_user,
 			   income,
 			   label
 		from cte
 	`
-	if _, err := sess.SelectBySql(q, botID, start, end, start, end).Load(&conversions); err != nil {
+	if _, err := sess.SelectBySql(q, append(args, botID, start, end, start, end)...).Load(&conversions); err != nil {
 		return nil, fmt.Errorf("SelectBotLeadsByDeeplinks: %w", err)
 	}
 
@@ -285,19 +299,18 @@ func (c *Client) SelectBotExpensesByPeriod(botID int, period string, start, end
 	sess := c.GetSession()
 	res := make(map[string]*types.ConversionRow, 0)
 	expenses := make([]*types.ConversionRow, 0)
+	spend, args := deeplinkSpendCTE(botID)
 	q := `
+		with ` + spend + `
 		select sum(clicks)                  as clicks,
 			   sum(impressions)             as impressions,
 			   sum(spend)                   as expense,
-			   date_trunc(?, fcs.date) 		as by_period
-		from deeplinks d
-			   join fbtool_accounts fa on d.label = fa.fbtool_account_name
-			   join fbtool_campaigns_stats fcs on fa.fbtool_account_id = fcs.fbtool_account_id
-		where d.bot_id = ?
-		  and (date(fcs.date) > date(?) and date(fcs.date) <= date(?))
+			   date_trunc(?, ds.date) 		as by_period
+		from deeplink_spend ds
+		where (date(ds.date) > date(?) and date(ds.date) <= date(?))
 		group by by_period
 	`
-	if _, err := sess.SelectBySql(q, period, botID, start, end).Load(&expenses); err != nil {
+	if _, err := sess.SelectBySql(q, append(args, period, start, end)...).Load(&expenses); err != nil {
 		return nil, fmt.Errorf("SelectBotExpensesByPeriod: %w", err)
 	}
 
@@ -312,19 +325,18 @@ func (c *Client) SelectBotExpensesByDay(botID int, start, end time.Time) (map[st
 	sess := c.GetSession()
 	res := make(map[string]*types.ConversionRow, 0)
 	expenses := make([]*types.ConversionRow, 0)
+	spend, args := deeplinkSpendCTE(botID)
 	q := `
+		with ` + spend + `
 		select sum(clicks)                 as clicks,
 			   sum(impressions)            as impressions,
 			   sum(spend)                  as expense,
-			   date_trunc('day', fcs.date) as by_day
-		from deeplinks d
-         	   join fbtool_accounts fa on d.label = fa.fbtool_account_name
-         	   join fbtool_campaigns_stats fcs on fa.fbtool_account_id = fcs.fbtool_account_id
-		where d.bot_id = ?
-		  and (date(fcs.date) > date(?) and date(fcs.date) <= date(?))
+			   date_trunc('day', ds.date)  as by_day
+		from deeplink_spend ds
+		where (date(ds.date) > date(?) and date(ds.date) <= date(?))
 		group by by_day
 	`
-	if _, err := sess.SelectBySql(q, botID, start, end).Load(&expenses); err != nil {
+	if _, err := sess.SelectBySql(q, append(args, start, end)...).Load(&expenses); err != nil {
 		return nil, fmt.Errorf("SelectBotExpensesByDay: %w", err)
 	}
 
@@ -442,14 +454,13 @@ func (c *Client) SelectExpenseMetric(botID int, start, end, startPrev, endPrev t
 	sess := c.GetSession()
 	res := &types.MetricRow{}
 
+	spend, args := deeplinkSpendCTE(botID)
 	q := `
-		with cte as (select sum(spend)                                                          						as total,
-                    		sum(case when date(fcs.date) > date(?) and date(fcs.date) <= date(?) then spend else 0 end) as current_period,
-                    		sum(case when date(fcs.date) > date(?) and date(fcs.date) <= date(?) then spend else 0 end) as last_period
-             		 from deeplinks d
-                      		join fbtool_accounts fa on d.label = fa.fbtool_account_name
-                      		join fbtool_campaigns_stats fcs on fa.fbtool_account_id = fcs.fbtool_account_id
-             		 where d.bot_id = ?)
+		with ` + spend + `,
+			 cte as (select sum(spend)                                                          						as total,
+                    		sum(case when date(ds.date) > date(?) and date(ds.date) <= date(?) then spend else 0 end) as current_period,
+                    		sum(case when date(ds.date) > date(?) and date(ds.date) <= date(?) then spend else 0 end) as last_period
+             		 from deeplink_spend ds)
 
 		select coalesce(total, 0)                                                    as all_time,
 			   coalesce(current_period, 0)                                           as period,
@@ -459,7 +470,7 @@ func (c *Client) SelectExpenseMetric(botID int, start, end, startPrev, endPrev t
 				   else float4(current_period) / float4(last_period) * 100 - 100 end as diff
 		from cte
 	`
-	if _, err := sess.SelectBySql(q, start, end, startPrev, endPrev, botID).Load(&res); err != nil {
+	if _, err := sess.SelectBySql(q, append(args, start, end, startPrev, endPrev)...).Load(&res); err != nil {
 		return nil, fmt.Errorf("SelectExpenseMetric: %w", err)
 	}
 
@@ -496,14 +507,13 @@ func (c *Client) SelectClicksMetric(botID int, start, end, startPrev, endPrev ti
 	sess := c.GetSession()
 	res := &types.MetricRow{}
 
+	spend, args := deeplinkSpendCTE(botID)
 	q := `
-		with cte as (select sum(clicks)                                                          as total,
-                    		sum(case when date(fcs.date) > date(?) and date(fcs.date) <= date(?) then clicks else 0 end) as current_period,
-                    		sum(case when date(fcs.date) > date(?) and date(fcs.date) <= date(?) then clicks else 0 end) as last_period
-             		 from deeplinks d
-                      		  join fbtool_accounts fa on d.label = fa.fbtool_account_name
-                      		  join fbtool_campaigns_stats fcs on fa.fbtool_account_id = fcs.fbtool_account_id
-             		 where d.bot_id = ?)
+		with ` + spend + `,
+			 cte as (select sum(clicks)                                                          as total,
+                    		sum(case when date(ds.date) > date(?) and date(ds.date) <= date(?) then clicks else 0 end) as current_period,
+                    		sum(case when date(ds.date) > date(?) and date(ds.date) <= date(?) then clicks else 0 end) as last_period
+             		 from deeplink_spend ds)
 
 		select coalesce(total, 0)                                                    as all_time,
 			   coalesce(current_period, 0)                                           as period,
@@ -513,7 +523,7 @@ func (c *Client) SelectClicksMetric(botID int, start, end, startPrev, endPrev ti
 				   else float4(current_period) / float4(last_period) * 100 - 100 end as diff
 		from cte
 	`
-	if _, err := sess.SelectBySql(q, start, end, startPrev, endPrev, botID).Load(&res); err != nil {
+	if _, err := sess.SelectBySql(q, append(args, start, end, startPrev, endPrev)...).Load(&res); err != nil {
 		return nil, fmt.Errorf("SelectClicksMetric: %w", err)
 	}
 
@@ -526,11 +536,11 @@ func (c *Client) SelectUsersUniqueMetric(botID int, start, end, startPrev, endPr
 
 	q := `
 		with cte2 as (with cte as (select count(*)                                                                         as total,
-										  sum(case when seen < 1 then 1 else 0 end)                                        as uq,
+										  sum(case when ` + uniquePersonCondition + ` then 1 else 0 end)                     as uq,
 										  sum(case when date(created_at) > date(?) and date(created_at) <= date(?) then 1 else 0 end)              as cp_total,
-										  sum(case when date(created_at) > date(?) and date(created_at) <= date(?) and seen < 1 then 1 else 0 end) as cp_uq,
+										  sum(case when date(created_at) > date(?) and date(created_at) <= date(?) and ` + uniquePersonCondition + ` then 1 else 0 end) as cp_uq,
 										  sum(case when date(created_at) > date(?) and date(created_at) <= date(?) then 1 else 0 end)              as lp_total,
-										  sum(case when date(created_at) > date(?) and date(created_at) <= date(?) and seen < 1 then 1 else 0 end) as lp_uq
+										  sum(case when date(created_at) > date(?) and date(created_at) <= date(?) and ` + uniquePersonCondition + ` then 1 else 0 end) as lp_uq
 								   from users
 								   where bot_id = ?)
 					  select case when total = 0 then 0 else uq::float4 / total::float4 * 100 end          as all_time,
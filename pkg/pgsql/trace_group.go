@@ -0,0 +1,234 @@
+package pgsql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+func (c *Client) CreateTraceGroup(group *types.TraceGroup) error {
+	sess := c.GetSession()
+
+	if err := sess.InsertInto("trace_groups").
+		Columns(
+			"trace_uuid",
+			"name",
+			"depot_channel_hash",
+			"telegram_channel_id",
+			"telegram_channel_url",
+			"binding_policy",
+		).
+		Record(group).
+		Returning("id", "created_at", "updated_at").
+		Load(group); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			if pqErr.Code == "23505" {
+				return ErrAlreadyExists
+			}
+		}
+		return fmt.Errorf("failed to create trace group: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureTraceGroup creates a group named after the trace uuid unless it exists,
+// so bots bound by a bare trace uuid show up in the groups.
+func (c *Client) EnsureTraceGroup(traceUUID uuid.UUID) error {
+	sess := c.GetSession()
+
+	if traceUUID == uuid.Nil {
+		return nil
+	}
+
+	q := `insert into trace_groups (trace_uuid, name) values (?, ?) on conflict do nothing`
+	if _, err := sess.InsertBySql(q, traceUUID, traceUUID.String()).Exec(); err != nil {
+		return fmt.Errorf("failed to ensure trace group: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) UpdateTraceGroup(group *types.TraceGroup) error {
+	sess := c.GetSession()
+
+	q := `update trace_groups
+		  set name                 = ?,
+			  depot_channel_hash   = ?,
+			  telegram_channel_id  = ?,
+			  telegram_channel_url = ?,
+			  binding_policy       = ?,
+			  updated_at           = now()
+		  where trace_uuid = ?`
+	res, err := sess.UpdateBySql(q,
+		group.Name,
+		group.DepotChannelHash,
+		group.TelegramChannelID,
+		group.TelegramChannelURL,
+		group.BindingPolicy,
+		group.TraceUUID,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to update trace group: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrTraceGroupNotFound
+	}
+
+	return nil
+}
+
+// DeleteTraceGroup removes the group and detaches its member bots, their users are kept.
+func (c *Client) DeleteTraceGroup(traceUUID uuid.UUID) error {
+	sess := c.GetSession()
+
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	q := `update bots set trace_uuid = ?, binding = false, updated_at = now() where trace_uuid = ?`
+	if _, err := tx.UpdateBySql(q, uuid.Nil, traceUUID).Exec(); err != nil {
+		return fmt.Errorf("failed to detach trace group bots: %w", err)
+	}
+
+	q = `delete from trace_groups where trace_uuid = ?`
+	res, err := tx.DeleteBySql(q, traceUUID).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to delete trace group: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrTraceGroupNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit tx: %w", err)
+	}
+
+	return nil
+}
+
+// SelectTraceGroup returns nil if the trace uuid has no group.
+func (c *Client) SelectTraceGroup(traceUUID uuid.UUID) (*types.TraceGroup, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.TraceGroup, 0)
+
+	q := `select * from trace_groups where trace_uuid = ? limit 1`
+	if _, err := sess.SelectBySql(q, traceUUID).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select trace group: %w", err)
+	}
+
+	if len(res) == 0 {
+		return nil, nil
+	}
+
+	return res[0], nil
+}
+
+func (c *Client) SelectTraceGroups() ([]*types.TraceGroup, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.TraceGroup, 0)
+
+	q := `select * from trace_groups order by id desc`
+	if _, err := sess.SelectBySql(q).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select trace groups: %w", err)
+	}
+
+	return res, nil
+}
+
+func (c *Client) SelectTraceGroupBots(traceUUID uuid.UUID) ([]*types.Bot, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.Bot, 0)
+
+	q := `select * from bots where trace_uuid = ? and deleted_at = ? order by id`
+	if _, err := sess.SelectBySql(q, traceUUID, time.Unix(0, 0).UTC()).Load(&res); err != nil {
+		return nil, fmt.Errorf("failed to select trace group bots: %w", err)
+	}
+
+	return res, nil
+}
+
+// UpdateBotsTraceGroup moves the bots to the trace group, uuid.Nil detaches them from any group.
+func (c *Client) UpdateBotsTraceGroup(botIDs []int, traceUUID uuid.UUID, binding bool) error {
+	sess := c.GetSession()
+
+	if len(botIDs) == 0 {
+		return nil
+	}
+
+	// deleted bots can't join a group, they are reported as not found
+	q := `update bots set trace_uuid = ?, binding = ?, updated_at = now() where id in ? and deleted_at = ?`
+	res, err := sess.UpdateBySql(q, traceUUID, binding, botIDs, time.Unix(0, 0).UTC()).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to update bots trace group: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if int(affected) != len(botIDs) {
+		return ErrBotNotFound
+	}
+
+	return nil
+}
+
+// SelectTraceGroupStats counts users of the group bots joined within the range, a telegram id
+// is counted once for the whole group by its first user in the group bots. Deleted bots are not members.
+func (c *Client) SelectTraceGroupStats(traceUUID uuid.UUID, start, end time.Time) (*types.TraceGroupStats, error) {
+	sess := c.GetSession()
+
+	botIDs := make([]int, 0)
+
+	q := `select id from bots where trace_uuid = ? and deleted_at = ? order by id`
+	if _, err := sess.SelectBySql(q, traceUUID, time.Unix(0, 0).UTC()).Load(&botIDs); err != nil {
+		return nil, fmt.Errorf("failed to select trace group bot ids: %w", err)
+	}
+
+	users := make([]*types.TraceGroupUser, 0)
+
+	if len(botIDs) > 0 {
+		q = `
+			with first_users as (select distinct on (telegram_id) id
+								 from users
+								 where bot_id in ?
+								 order by telegram_id, created_at, id)
+			select u.bot_id,
+				   u.telegram_id,
+				   u.deposited,
+				   f.id is not null as first
+			from users u
+					 left join first_users f on f.id = u.id
+			where u.bot_id in ?
+			  and (date(u.created_at) > date(?) and date(u.created_at) <= date(?))
+		`
+		if _, err := sess.SelectBySql(q, botIDs, botIDs, start, end).Load(&users); err != nil {
+			return nil, fmt.Errorf("failed to select trace group users: %w", err)
+		}
+	}
+
+	return types.NewTraceGroupStats(botIDs, users), nil
+}
@@ -2,8 +2,10 @@ package pgsql
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/lib/pq"
 
 	"github.com/prosperofair/stata/pkg/types"
@@ -100,37 +102,115 @@ func (c *Client) SelectAllUsersWithEmptyCreationEvent() ([]*types.User, error) {
 	return res, nil
 }
 
-func (c *Client) SelectUsersByForwardSenderName(fsn string) ([]*types.User, error) {
+type usersSearchRow struct {
+	types.User
+	Score float64 `db:"score"`
+}
+
+// SearchUsers returns a page of users matching the filter query ordered by relevance, prefix matches
+// rank above trigram matches. The cursor of the next page is nil when there are no more users.
+func (c *Client) SearchUsers(filter *types.UsersSearchFilter) ([]*types.User, *types.UsersSearchCursor, error) {
 	sess := c.GetSession()
 
-	res := make([]*types.User, 0)
+	q, args := searchUsersQuery(filter)
 
-	q := `select * from users where forward_sender_name = ?`
-	if _, err := sess.SelectBySql(q, fsn).Load(&res); err != nil {
-		return nil, err
+	rows := make([]*usersSearchRow, 0)
+	if _, err := sess.SelectBySql(q, args...).Load(&rows); err != nil {
+		return nil, nil, fmt.Errorf("failed to search users: %w", err)
 	}
 
-	return res, nil
+	var next *types.UsersSearchCursor
+	if len(rows) > filter.Limit {
+		rows = rows[:filter.Limit]
+
+		last := rows[len(rows)-1]
+		next = &types.UsersSearchCursor{
+			Score: last.Score,
+			ID:    last.ID,
+		}
+	}
+
+	res := make([]*types.User, 0, len(rows))
+	for _, row := range rows {
+		user := row.User
+		res = append(res, &user)
+	}
+
+	return res, next, nil
 }
 
-func (c *Client) SelectUsersByUsername(username string) ([]*types.User, error) {
-	sess := c.GetSession()
+// searchUsersQuery builds the search query, its args follow the placeholders:
+// the score and match args, the filter args, the cursor and the limit.
+func searchUsersQuery(filter *types.UsersSearchFilter) (string, []interface{}) {
+	query := strings.ToLower(filter.Query)
+	prefix := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(query) + "%"
 
-	res := make([]*types.User, 0)
-	q := `select * from users where username = ?`
-	if _, err := sess.SelectBySql(q, username).Load(&res); err != nil {
-		return nil, err
+	args := []interface{}{
+		query, prefix, query, prefix, query, prefix,
+		query, prefix, query, prefix, query, prefix,
 	}
 
-	return res, nil
+	conds := make([]string, 0)
+
+	if filter.BotID != 0 {
+		conds = append(conds, "users.bot_id = ?")
+		args = append(args, filter.BotID)
+	}
+
+	if filter.Deposited != nil {
+		conds = append(conds, "users.deposited = ?")
+		args = append(args, *filter.Deposited)
+	}
+
+	if filter.CreatedFrom != nil {
+		conds = append(conds, "users.created_at >= ?")
+		args = append(args, *filter.CreatedFrom)
+	}
+
+	if filter.CreatedTo != nil {
+		conds = append(conds, "users.created_at <= ?")
+		args = append(args, *filter.CreatedTo)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " and " + strings.Join(conds, " and ")
+	}
+
+	cursor := ""
+	if filter.Cursor != nil {
+		cursor = " where (score, id) < (?, ?)"
+		args = append(args, filter.Cursor.Score, filter.Cursor.ID)
+	}
+
+	// one extra row tells whether there is a next page
+	args = append(args, filter.Limit+1)
+
+	q := `select *
+		  from (select users.*,
+					   greatest(similarity(users.username, ?) + case when lower(users.username) like ? then 1 else 0 end,
+								similarity(users.forward_sender_name, ?) + case when lower(users.forward_sender_name) like ? then 1 else 0 end,
+								similarity(users.first_name || ' ' || users.last_name, ?) +
+								case when lower(users.first_name || ' ' || users.last_name) like ? then 1 else 0 end)::float8 as score
+				from users
+				where (users.username % ? or users.username ilike ?
+				   or users.forward_sender_name % ? or users.forward_sender_name ilike ?
+				   or (users.first_name || ' ' || users.last_name) % ? or (users.first_name || ' ' || users.last_name) ilike ?)` + where + `) found` + cursor + `
+		  order by score desc, id desc
+		  limit ?`
+
+	return q, args
 }
 
-func (c *Client) SelectRandomReadyUsersByDepotChannelHash(botID int, hash string, limit int) ([]*types.User, error) {
+func (c *Client) SelectRandomReadyUsersByDepotChannelHash(botID int, hash string, filter *types.MailingSegmentFilter, limit int) ([]*types.User, error) {
 	sess := c.GetSession()
 
+	cond, args := segmentCondition(filter)
+
 	res := make([]*types.User, 0)
-	q := `select * from users where mailing_state = ? and bot_id = ? and depot_channel_hash = ? order by random() limit ?`
-	if _, err := sess.SelectBySql(q, types.UserMailingStateReady, botID, hash, limit).Load(&res); err != nil {
+	q := `select * from users where mailing_state = ? and bot_id = ? and depot_channel_hash = ?` + notErasedCondition + cond + ` order by random() limit ?`
+	params := append([]interface{}{types.UserMailingStateReady, botID, hash}, args...)
+	if _, err := sess.SelectBySql(q, append(params, limit)...).Load(&res); err != nil {
 		return nil, err
 	}
 
@@ -155,12 +235,14 @@ func (c *Client) SetBotUsersMailingStatesReady(botID int, hash string) error {
 
 	q := `update users
 	set mailing_state            = ?,
+		mailing_lease_id         = ?,
 		mailing_state_updated_at = now()
 	where bot_id = ?
 	  and depot_channel_hash = ?
 	  and mailing_state = any (?)`
 	if _, err := sess.UpdateBySql(q,
 		types.UserMailingStateReady,
+		uuid.Nil,
 		botID,
 		hash,
 		pq.Array(states),
@@ -174,6 +256,14 @@ func (c *Client) SetBotUsersMailingStatesReady(botID int, hash string) error {
 func (c *Client) UpdateBotUsersSetDefaultChannel(botID int, hash string, tgchid int64, tgchurl string) error {
 	sess := c.GetSession()
 
+	tx, err := sess.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	ids := make([]int, 0)
+
 	q := `update users
 	set telegram_channel_id  = ?,
 		telegram_channel_url = ?,
@@ -181,45 +271,142 @@ func (c *Client) UpdateBotUsersSetDefaultChannel(botID int, hash string, tgchid
 	where bot_id = ?
 	  and depot_channel_hash = ''
 	  and telegram_channel_id = 0
-	  and telegram_channel_url = ''`
-	if _, err := sess.UpdateBySql(q, tgchid, tgchurl, hash, botID).Exec(); err != nil {
+	  and telegram_channel_url = ''
+	returning id`
+	if _, err := tx.SelectBySql(q, tgchid, tgchurl, hash, botID).Load(&ids); err != nil {
 		return err
 	}
 
-	return nil
+	if err := openUserChannelAssignments(tx, ids, types.ChannelAssignmentReasonDefault, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (c *Client) UpdateBotUsersTelegramChannel(botID int, hash string, tgchid int64, tgchurl string) error {
+// SelectUsersWithoutChannel returns the users of active bots which were never assigned a channel,
+// newest first and older than the beforeID user unless it's zero.
+func (c *Client) SelectUsersWithoutChannel(beforeID, limit int) ([]*types.User, error) {
+	sess := c.GetSession()
+
+	res := make([]*types.User, 0)
+
+	q := `select users.*
+		  from users
+				   join bots b on b.id = users.bot_id
+		  where b.active = true
+			and users.depot_channel_hash = ''
+			and users.telegram_channel_id = 0
+			and (? = 0 or users.id < ?)
+		  order by users.id desc
+		  limit ?`
+	if _, err := sess.SelectBySql(q, beforeID, beforeID, limit).Load(&res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// UpdateUserChannel assigns the channel to the user unless the user got one meanwhile.
+func (c *Client) UpdateUserChannel(userID int, channel *types.UserChannel) error {
 	sess := c.GetSession()
 
 	q := `update users
-	set telegram_channel_id  = ?,
+	set depot_channel_hash   = ?,
+		telegram_channel_id  = ?,
 		telegram_channel_url = ?,
-		subscribed = false,
-		subscribed_at = created_at,
-		unsubscribed_at = created_at
-	where bot_id = ?
-	  and depot_channel_hash = ?`
-	if _, err := sess.UpdateBySql(q, tgchid, tgchurl, botID, hash).Exec(); err != nil {
+		updated_at = now()
+	where id = ?
+	  and depot_channel_hash = ''`
+	res, err := sess.UpdateBySql(q,
+		channel.DepotChannelHash,
+		channel.TelegramChannelID,
+		channel.TelegramChannelURL,
+		userID,
+	).Exec()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return nil
+	}
+
+	return openUserChannelAssignments(sess, []int{userID}, types.ChannelAssignmentReasonAssigned, 0)
 }
 
-func (c *Client) UpdateBotUserMailingState(botToken string, telegramID int64, state string) error {
+// UpdateBotUsersTelegramChannel moves the users of the depot channel to the telegram channel,
+// the users are selected and locked in the reassign transaction so none is changed in between.
+func (c *Client) UpdateBotUsersTelegramChannel(botID int, hash string, tgchid int64, tgchurl string) error {
 	sess := c.GetSession()
 
-	if state == types.UserMailingStateBlocked {
-		qtpl := `update users
-set mailing_state            = case when mailing_failed_attempts + 1 >= %d then '%s' else '%s' end,
-    mailing_failed_attempts  = mailing_failed_attempts + 1,
-    mailing_state_updated_at = now()
-where bot_id = (select id from bots where bot_token = ?)
-  and telegram_id = ?;`
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin telegram channel update transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	ids := make([]int, 0)
+
+	q := `select id from users where bot_id = ? and depot_channel_hash = ? for update`
+	if _, err := tx.SelectBySql(q, botID, hash).Load(&ids); err != nil {
+		return err
+	}
 
-		q := fmt.Sprintf(qtpl, types.UserMailingMaxFailedAttempts, types.UserMailingStateBlocked, types.UserMailingStateFinished)
-		if _, err := sess.UpdateBySql(q, botToken, telegramID).Exec(); err != nil {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := c.reassignUsersChannel(tx, ids, &types.UserChannel{
+		DepotChannelHash:   hash,
+		TelegramChannelID:  tgchid,
+		TelegramChannelURL: tgchurl,
+	}, types.ChannelAssignmentReasonUpdate, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateBotUserMailingState moves the user to the state reported by the sender and records the delivery.
+// Blocked users with a permanent error reason are blocked at once, others only after
+// UserMailingMaxFailedAttempts transient failures in a row.
+func (c *Client) UpdateBotUserMailingState(botToken string, telegramID int64, state, reason string, campaignID int) error {
+	sess := c.GetSession()
+
+	reason = types.TruncateMailingError(reason, types.MailingErrorReasonMaxLength)
+
+	if state == types.UserMailingStateBlocked {
+		permanent := types.IsPermanentMailingError(reason)
+
+		q := `
+			with updated as (update users
+							 set mailing_state            = case when ? or mailing_failed_attempts + 1 >= ? then ? else ? end,
+								 mailing_failed_attempts  = case when ? then greatest(mailing_failed_attempts + 1, ?) else mailing_failed_attempts + 1 end,
+								 mailing_error_reason     = ?,
+								 mailing_lease_id         = ?,
+								 mailing_state_updated_at = now()
+							 where bot_id = ` + botIDByTokenSQL + `
+							   and telegram_id = ?
+							 returning id, bot_id, mailing_state)
+			insert into mailing_deliveries (bot_id, user_id, campaign_id, event, reason, permanent)
+			select bot_id, id, ?, case when mailing_state = ? then ? else ? end, ?, ?
+			from updated
+		`
+		if _, err := sess.UpdateBySql(q,
+			permanent, types.UserMailingMaxFailedAttempts, types.UserMailingStateBlocked, types.UserMailingStateFinished,
+			permanent, types.UserMailingMaxFailedAttempts,
+			reason,
+			uuid.Nil,
+			botToken, botToken,
+			telegramID,
+			campaignID, types.UserMailingStateBlocked, types.MailingDeliveryEventBlocked, types.MailingDeliveryEventFailed, reason, permanent,
+		).Exec(); err != nil {
 			return err
 		}
 
@@ -227,22 +414,48 @@ where bot_id = (select id from bots where bot_token = ?)
 		q := `update users
 set mailing_state            = ?,
     mailing_failed_attempts  = 0,
+    mailing_lease_id         = ?,
+    mailed_at                = case when ? then now() else mailed_at end,
     mailing_state_updated_at = now()
-where bot_id = (select id from bots where bot_token = ?)
-  and telegram_id = ?;`
-		if _, err := sess.UpdateBySql(q, state, botToken, telegramID).Exec(); err != nil {
+where bot_id = ` + botIDByTokenSQL + `
+  and telegram_id = ?
+returning id, bot_id;`
+		mailed := state == types.UserMailingStateFinished
+
+		updated := make([]*types.User, 0)
+		if _, err := sess.SelectBySql(q, state, uuid.Nil, mailed, botToken, botToken, telegramID).Load(&updated); err != nil {
 			return err
 		}
 
+		if mailed {
+			for _, u := range updated {
+				if err := c.CreateMailingDelivery(&types.MailingDelivery{
+					BotID:      u.BotID,
+					UserID:     u.ID,
+					CampaignID: campaignID,
+					Event:      types.MailingDeliveryEventSent,
+				}); err != nil {
+					return err
+				}
+			}
+		}
+
 	}
 
 	return nil
 }
 
+// CreateUser inserts the user, opens its channel assignment and updates its person in one transaction.
 func (c *Client) CreateUser(user *types.User) error {
 	sess := c.GetSession()
 
-	if _, err := sess.InsertInto("users").
+	tx, err := sess.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	if err := tx.InsertInto("users").
 		Columns(
 			"bot_id",
 			"deeplink_id",
@@ -261,17 +474,34 @@ func (c *Client) CreateUser(user *types.User) error {
 			"event_created",
 			"invite_uuid",
 		).
-		Record(user).Exec(); err != nil {
+		Record(user).
+		Returning("id").
+		Load(&user.ID); err != nil {
 		return err
 	}
 
-	return nil
+	if err := openUserChannelAssignments(tx, []int{user.ID}, types.ChannelAssignmentReasonAssigned, 0); err != nil {
+		return err
+	}
+
+	if err := upsertPersons(tx, []int64{user.TelegramID}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
+// CreateUsers inserts the users and updates their persons in one transaction.
 func (c *Client) CreateUsers(users []types.User) error {
 	sess := c.GetSession()
 
-	stmt := sess.InsertInto("users").Columns(
+	tx, err := sess.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.RollbackUnlessCommitted()
+
+	stmt := tx.InsertInto("users").Columns(
 		"bot_id",
 		"deeplink_id",
 		"depot_channel_hash",
@@ -309,17 +539,21 @@ func (c *Client) CreateUsers(users []types.User) error {
 		"unsubscribed_at",
 	)
 
+	telegramIDs := make([]int64, 0, len(users))
 	for _, user := range users {
 		stmt = stmt.Record(user)
+		telegramIDs = append(telegramIDs, user.TelegramID)
 	}
 
-	_, err := stmt.Exec()
+	if _, err := stmt.Exec(); err != nil {
+		return err
+	}
 
-	if err != nil {
+	if err := upsertPersons(tx, telegramIDs); err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 func (c *Client) UpdateUserMessagedAt(id int) error {
@@ -336,9 +570,16 @@ func (c *Client) UpdateUserMessagedAt(id int) error {
 func (c *Client) UpdateUserOnMessage(old, new *types.User) error {
 	sess := c.GetSession()
 
+	// the channel assignment history is closed and reopened along with the users row
+	tx, err := sess.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin user update transaction: %w", err)
+	}
+	defer tx.RollbackUnlessCommitted()
+
 	updated := false
 
-	stmt := sess.Update("users").
+	stmt := tx.Update("users").
 		Set("messaged_at", "now()")
 
 	if old.Firstname != new.Firstname && new.Firstname != "" {
@@ -378,7 +619,8 @@ func (c *Client) UpdateUserOnMessage(old, new *types.User) error {
 		updated = true
 	}
 
-	if old.DepotChannelHash != new.DepotChannelHash && new.DepotChannelHash != "" {
+	channelChanged := old.DepotChannelHash != new.DepotChannelHash && new.DepotChannelHash != ""
+	if channelChanged {
 		stmt.Set("depot_channel_hash", new.DepotChannelHash)
 		stmt.Set("telegram_channel_id", new.TelegramChannelID)
 		stmt.Set("telegram_channel_url", new.TelegramChannelURL)
@@ -401,11 +643,37 @@ func (c *Client) UpdateUserOnMessage(old, new *types.User) error {
 		}
 	}
 
+	if channelChanged {
+		if err := closeUserChannelAssignments(tx, []int{old.ID}); err != nil {
+			return err
+		}
+	}
+
 	stmt = stmt.Where("id = ?", old.ID)
 	if _, err := stmt.Exec(); err != nil {
 		return err
 	}
 
+	if channelChanged {
+		if err := openUserChannelAssignments(tx, []int{old.ID}, types.ChannelAssignmentReasonAssigned, 0); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit user update transaction: %w", err)
+	}
+
+	if old.MailingState == types.UserMailingStateBlocked {
+		if err := c.CreateMailingDelivery(&types.MailingDelivery{
+			BotID:  old.BotID,
+			UserID: old.ID,
+			Event:  types.MailingDeliveryEventUnblocked,
+		}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -4,10 +4,13 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/prosperofair/pkg/log"
+	"github.com/prosperofair/stata/pkg/pgsql"
 	"github.com/prosperofair/stata/pkg/types"
 	"go.uber.org/zap"
 )
@@ -24,6 +27,14 @@ type BotsRegisterResponse struct {
 }
 
 func (req *BotsRegisterRequest) validate() error {
+	if req.APIKey == "" {
+		return errors.New("api_key is required")
+	}
+
+	if len(req.BuyerID) > 32 {
+		return errors.New("bid is too long")
+	}
+
 	return nil
 }
 
@@ -52,15 +63,27 @@ func (s *Server) BotsRegisterHandler(c *fiber.Ctx) error {
 		return s.InternalServerError(c, err)
 	}
 
+	if err := s.deps.PG.EnsureTraceGroup(bot.TraceUUID); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
 	return s.ResponseOK(c)
 }
 
 type BotsImportRequest struct {
 	Bots []BotsRegisterRequest `json:"bots"`
+
+	// Atomic runs the import in a single transaction, nothing is imported if any bot fails
+	Atomic bool `json:"atomic"`
 }
 
 type BotsImportResponse struct {
 	Affected int `json:"affected"`
+	Created  int `json:"created"`
+	Updated  int `json:"updated"`
+	Failed   int `json:"failed"`
+
+	Results []*types.BotImportResult `json:"results"`
 }
 
 func (s *Server) BotsImportHandler(c *fiber.Ctx) error {
@@ -69,29 +92,136 @@ func (s *Server) BotsImportHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	res := &BotsImportResponse{
-		Affected: 0,
+	bots := make([]*types.Bot, 0, len(req.Bots))
+	for _, bot := range req.Bots {
+		bots = append(bots, &types.Bot{
+			APIKey:      bot.APIKey,
+			BotUsername: bot.BotUsername,
+			BotType:     bot.BotType,
+			BID:         bot.BuyerID,
+			TraceUUID:   bot.TraceUUID,
+		})
 	}
 
-	for _, bot := range req.Bots {
-		if err := bot.validate(); err != nil {
-			return s.BadRequest(c, err)
-		}
+	return s.importBots(c, bots, req.Atomic)
+}
 
-		hash := md5.Sum([]byte(bot.APIKey))
+// botsImportCSVHandler imports bots from a multipart csv file,
+// see types.ParseBotsCSV for the expected columns.
+func (s *Server) botsImportCSVHandler(c *fiber.Ctx) error {
+	atomic := c.FormValue("atomic") == "true"
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return s.BadRequest(c, fmt.Errorf("file is missing: %w", err))
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+	defer f.Close()
+
+	bots, err := types.ParseBotsCSV(f)
+	if err != nil {
+		return s.BadRequest(c, err)
+	}
 
-		if err := s.deps.PG.CreateBot(&types.Bot{
+	return s.importBots(c, bots, atomic)
+}
+
+func (s *Server) importBots(c *fiber.Ctx, bots []*types.Bot, atomic bool) error {
+	res := &BotsImportResponse{
+		Results: make([]*types.BotImportResult, len(bots)),
+	}
+
+	valid := make([]*types.Bot, 0, len(bots))
+	indexes := make([]int, 0, len(bots))
+
+	for i, bot := range bots {
+		req := &BotsRegisterRequest{
 			APIKey:      bot.APIKey,
-			BotToken:    hex.EncodeToString(hash[:]),
 			BotUsername: bot.BotUsername,
 			BotType:     bot.BotType,
+			BuyerID:     bot.BID,
 			TraceUUID:   bot.TraceUUID,
-		}); err != nil {
-			log.Error("failed to create bot", zap.Error(err))
+		}
+
+		if err := req.validate(); err != nil {
+			res.Results[i] = &types.BotImportResult{
+				Index:       i,
+				BotUsername: bot.BotUsername,
+				Status:      types.BotImportStatusFailed,
+				Reason:      err.Error(),
+			}
+			continue
+		}
+
+		hash := md5.Sum([]byte(bot.APIKey))
+		bot.BotToken = hex.EncodeToString(hash[:])
+
+		valid = append(valid, bot)
+		indexes = append(indexes, i)
+	}
+
+	// invalid bots fail the whole atomic import before touching the database
+	if atomic && len(valid) != len(bots) {
+		for i, result := range res.Results {
+			if result == nil {
+				res.Results[i] = &types.BotImportResult{
+					Index:       i,
+					BotUsername: bots[i].BotUsername,
+					BotToken:    bots[i].BotToken,
+					Status:      types.BotImportStatusFailed,
+					Reason:      "import is rolled back",
+				}
+			}
+		}
+
+		res.Failed = len(bots)
+
+		return c.JSON(res)
+	}
+
+	results, err := s.deps.PG.ImportBots(valid, atomic)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	for i, result := range results {
+		result.Index = indexes[i]
+		res.Results[indexes[i]] = result
+
+		if result.Status == types.BotImportStatusFailed {
 			continue
 		}
 
-		res.Affected++
+		if err := s.deps.PG.EnsureTraceGroup(valid[i].TraceUUID); err != nil {
+			log.Error("failed to ensure trace group", zap.Error(err))
+		}
+	}
+
+	for _, result := range res.Results {
+		switch result.Status {
+		case types.BotImportStatusCreated:
+			res.Created++
+		case types.BotImportStatusUpdated:
+			res.Updated++
+		default:
+			res.Failed++
+
+			log.Warn("failed to import bot",
+				zap.Int("index", result.Index),
+				zap.String("reason", result.Reason))
+		}
+	}
+
+	res.Affected = res.Created + res.Updated
+
+	if res.Updated > 0 {
+		if err := s.bots.Reload(); err != nil {
+			log.Error("failed to reload bot registry", zap.Error(err))
+		}
 	}
 
 	return c.JSON(res)
@@ -121,15 +251,274 @@ func (s *Server) BotsUpdateBindingHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	if err := s.deps.PG.UpdateBotBinding(req.BotToken, req.Binding); err != nil {
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateBotBinding(bot.ID, req.Binding); err != nil {
 		return s.InternalServerError(c, err)
 	}
 
 	if req.TraceUUID != uuid.Nil {
-		if err := s.deps.PG.UpdateBotTraceUUID(req.BotToken, req.TraceUUID); err != nil {
+		if err := s.deps.PG.UpdateBotTraceUUID(bot.ID, req.TraceUUID); err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		if err := s.deps.PG.EnsureTraceGroup(req.TraceUUID); err != nil {
 			return s.InternalServerError(c, err)
 		}
 	}
 
+	s.bots.Invalidate(bot.BotToken)
+
+	return s.ResponseOK(c)
+}
+
+// errBotInactive is returned by the event endpoints for deactivated and deleted bots.
+var errBotInactive = errors.New("bot is inactive")
+
+// botError responds with 400 to unknown bots, tokens resolve to bots by their current token
+// or the alias of a rotated one.
+func (s *Server) botError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, pgsql.ErrBotNotFound) {
+		return s.BadRequest(c, err)
+	}
+
+	return s.InternalServerError(c, err)
+}
+
+type botsListRequest struct {
+	BID       string     `json:"bid"`
+	BotType   string     `json:"bot_type"`
+	Active    *bool      `json:"active"`
+	TraceUUID *uuid.UUID `json:"trace_uuid"`
+
+	IncludeDeleted bool `json:"include_deleted"`
+}
+
+type botsListResponse struct {
+	Bots []*types.Bot `json:"bots"`
+}
+
+func (s *Server) botsListHandler(c *fiber.Ctx) error {
+	req := &botsListRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bots, err := s.deps.PG.SelectBots(&types.BotsFilter{
+		BID:            req.BID,
+		BotType:        req.BotType,
+		Active:         req.Active,
+		TraceUUID:      req.TraceUUID,
+		IncludeDeleted: req.IncludeDeleted,
+	})
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&botsListResponse{
+		Bots: bots,
+	})
+}
+
+type botsTokenRequest struct {
+	BotToken string `json:"bot_token"`
+}
+
+func (req *botsTokenRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is required")
+	}
+
+	return nil
+}
+
+func (s *Server) botsGetHandler(c *fiber.Ctx) error {
+	req := &botsTokenRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	return c.JSON(bot)
+}
+
+type botsUpdateBuyerRequest struct {
+	BotToken string `json:"bot_token"`
+	BuyerID  string `json:"bid"`
+}
+
+func (req *botsUpdateBuyerRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is required")
+	}
+
+	return nil
+}
+
+func (s *Server) botsUpdateBuyerHandler(c *fiber.Ctx) error {
+	req := &botsUpdateBuyerRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateBotBuyerID(bot.ID, req.BuyerID); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	s.bots.Invalidate(bot.BotToken)
+
+	return s.ResponseOK(c)
+}
+
+type botsRotateTokenRequest struct {
+	BotToken    string `json:"bot_token"`
+	APIKey      string `json:"api_key"`
+	GracePeriod int    `json:"grace_period"`
+}
+
+type botsRotateTokenResponse struct {
+	Bot   *types.Bot           `json:"bot"`
+	Alias *types.BotTokenAlias `json:"alias"`
+}
+
+func (req *botsRotateTokenRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is required")
+	}
+
+	if req.APIKey == "" {
+		return errors.New("api_key is required")
+	}
+
+	if req.GracePeriod < 0 || time.Duration(req.GracePeriod)*time.Second > types.BotTokenMaxGracePeriod {
+		return errors.New("invalid grace_period")
+	}
+
+	return nil
+}
+
+func (s *Server) botsRotateTokenHandler(c *fiber.Ctx) error {
+	req := &botsRotateTokenRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	if bot.APIKey == req.APIKey {
+		return s.BadRequest(c, errors.New("api_key is not changed"))
+	}
+
+	grace := types.BotTokenDefaultGracePeriod
+	if req.GracePeriod != 0 {
+		grace = time.Duration(req.GracePeriod) * time.Second
+	}
+
+	hash := md5.Sum([]byte(req.APIKey))
+	token := hex.EncodeToString(hash[:])
+
+	alias, err := s.deps.PG.RotateBotToken(bot, req.APIKey, token, grace)
+	if err != nil {
+		if errors.Is(err, pgsql.ErrAlreadyExists) {
+			return s.BadRequest(c, errors.New("api_key is used by another bot"))
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	s.bots.Invalidate(bot.BotToken)
+
+	bot.APIKey = req.APIKey
+	bot.BotToken = token
+
+	return c.JSON(&botsRotateTokenResponse{
+		Bot:   bot,
+		Alias: alias,
+	})
+}
+
+func (s *Server) botsDeactivateHandler(c *fiber.Ctx) error {
+	return s.botsSetActive(c, false)
+}
+
+func (s *Server) botsActivateHandler(c *fiber.Ctx) error {
+	return s.botsSetActive(c, true)
+}
+
+func (s *Server) botsSetActive(c *fiber.Ctx, active bool) error {
+	req := &botsTokenRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	if !bot.DeletedAt.Equal(time.Unix(0, 0).UTC()) {
+		return s.BadRequest(c, errors.New("bot is deleted"))
+	}
+
+	if err := s.deps.PG.UpdateBotActive(bot.ID, active); err != nil {
+		return s.botError(c, err)
+	}
+
+	s.bots.Invalidate(bot.BotToken)
+
+	return s.ResponseOK(c)
+}
+
+func (s *Server) botsDeleteHandler(c *fiber.Ctx) error {
+	req := &botsTokenRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	if err := s.deps.PG.DeleteBot(bot.ID); err != nil {
+		return s.botError(c, err)
+	}
+
+	s.bots.Invalidate(bot.BotToken)
+
 	return s.ResponseOK(c)
 }
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prosperofair/pkg/log"
+	"go.uber.org/zap"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// botRegistryStore is the part of the postgres client the registry loads bots from.
+type botRegistryStore interface {
+	SelectAllBots() (map[int]*types.Bot, error)
+	SelectActiveBotTokenAliases() ([]*types.BotTokenAlias, error)
+	SelectBotByToken(token string) (*types.Bot, error)
+	SelectBotByID(id int) (*types.Bot, error)
+}
+
+type botRegistryAlias struct {
+	botID     int
+	expiresAt time.Time
+}
+
+// botRegistry keeps bots in memory so the event endpoints don't query them on every request.
+// Changes made through this instance invalidate the bot right away, changes made by other
+// instances are picked up by the periodic reload.
+type botRegistry struct {
+	pg      botRegistryStore
+	enabled bool
+
+	mu sync.RWMutex
+	// generation is bumped by every invalidation, bots read from the database before
+	// an invalidation are not cached as they may predate the change
+	generation uint64
+	byID       map[int]*types.Bot
+	byToken    map[string]*types.Bot
+	aliases    map[string]*botRegistryAlias
+}
+
+func newBotRegistry(pg botRegistryStore, enabled bool) *botRegistry {
+	return &botRegistry{
+		pg:      pg,
+		enabled: enabled,
+		byID:    make(map[int]*types.Bot),
+		byToken: make(map[string]*types.Bot),
+		aliases: make(map[string]*botRegistryAlias),
+	}
+}
+
+// Run reloads the registry on every tick.
+func (r *botRegistry) Run(interval time.Duration) {
+	if err := r.Reload(); err != nil {
+		log.Error("failed to load bot registry", zap.Error(err))
+	}
+
+	for range time.Tick(interval) {
+		if err := r.Reload(); err != nil {
+			log.Error("failed to reload bot registry", zap.Error(err))
+		}
+	}
+}
+
+// Reload replaces the registry with the bots and token aliases stored in the database.
+func (r *botRegistry) Reload() error {
+	if !r.enabled {
+		return nil
+	}
+
+	generation := r.currentGeneration()
+
+	bots, err := r.pg.SelectAllBots()
+	if err != nil {
+		return err
+	}
+
+	aliases, err := r.pg.SelectActiveBotTokenAliases()
+	if err != nil {
+		return err
+	}
+
+	byToken := make(map[string]*types.Bot, len(bots))
+	for _, bot := range bots {
+		byToken[bot.BotToken] = bot
+	}
+
+	byAlias := make(map[string]*botRegistryAlias, len(aliases))
+	for _, alias := range aliases {
+		byAlias[alias.BotToken] = &botRegistryAlias{
+			botID:     alias.BotID,
+			expiresAt: alias.ExpiresAt,
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the snapshot may hold bots invalidated while it was read, the next reload replaces the registry
+	if r.generation != generation {
+		log.Info("skipped bot registry reload invalidated while loading")
+		return nil
+	}
+
+	r.byID = bots
+	r.byToken = byToken
+	r.aliases = byAlias
+
+	metricBotRegistrySize.Set(float64(len(bots)))
+
+	return nil
+}
+
+// Get returns the bot by its token or by the previous token of a rotated bot.
+func (r *botRegistry) Get(botToken string) (*types.Bot, error) {
+	if bot, ok := r.cachedByToken(botToken); ok {
+		metricBotRegistryLookups.WithLabelValues("hit").Inc()
+		return bot, nil
+	}
+
+	metricBotRegistryLookups.WithLabelValues("miss").Inc()
+
+	generation := r.currentGeneration()
+
+	bot, err := r.pg.SelectBotByToken(botToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// aliases resolved here are cached by the next reload along with their expiration
+	if bot.BotToken == botToken {
+		r.store(bot, generation)
+	}
+
+	res := *bot
+
+	return &res, nil
+}
+
+func (r *botRegistry) GetByID(id int) (*types.Bot, error) {
+	if bot, ok := r.cachedByID(id); ok {
+		metricBotRegistryLookups.WithLabelValues("hit").Inc()
+		return bot, nil
+	}
+
+	metricBotRegistryLookups.WithLabelValues("miss").Inc()
+
+	generation := r.currentGeneration()
+
+	bot, err := r.pg.SelectBotByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.store(bot, generation)
+
+	res := *bot
+
+	return &res, nil
+}
+
+// Invalidate drops the bots so the next lookup loads them from the database,
+// tokens may be current tokens as well as aliases.
+func (r *botRegistry) Invalidate(botTokens ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+
+	for _, token := range botTokens {
+		if bot, ok := r.byToken[token]; ok {
+			r.remove(bot.ID)
+		}
+
+		if alias, ok := r.aliases[token]; ok {
+			r.remove(alias.botID)
+		}
+	}
+
+	metricBotRegistrySize.Set(float64(len(r.byID)))
+}
+
+// remove expects the lock to be held.
+func (r *botRegistry) remove(id int) {
+	bot, ok := r.byID[id]
+	if !ok {
+		return
+	}
+
+	delete(r.byID, id)
+	delete(r.byToken, bot.BotToken)
+
+	for token, alias := range r.aliases {
+		if alias.botID == id {
+			delete(r.aliases, token)
+		}
+	}
+}
+
+// store caches the bot unless an invalidation happened since the generation it was read at.
+func (r *botRegistry) store(bot *types.Bot, generation uint64) {
+	if !r.enabled {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generation != generation {
+		return
+	}
+
+	r.byID[bot.ID] = bot
+	r.byToken[bot.BotToken] = bot
+
+	metricBotRegistrySize.Set(float64(len(r.byID)))
+}
+
+func (r *botRegistry) currentGeneration() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.generation
+}
+
+func (r *botRegistry) cachedByToken(botToken string) (*types.Bot, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bot, ok := r.byToken[botToken]
+	if !ok {
+		alias, found := r.aliases[botToken]
+		if !found || time.Now().After(alias.expiresAt) {
+			return nil, false
+		}
+
+		if bot, ok = r.byID[alias.botID]; !ok {
+			return nil, false
+		}
+	}
+
+	res := *bot
+
+	return &res, true
+}
+
+func (r *botRegistry) cachedByID(id int) (*types.Bot, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	bot, ok := r.byID[id]
+	if !ok {
+		return nil, false
+	}
+
+	res := *bot
+
+	return &res, true
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prosperofair/stata/pkg/pgsql"
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+type botRegistryStoreMock struct {
+	bots    map[int]*types.Bot
+	aliases []*types.BotTokenAlias
+	queries int
+
+	// beforeAliases runs between the bots and aliases reads of a reload
+	beforeAliases func()
+}
+
+func (m *botRegistryStoreMock) SelectAllBots() (map[int]*types.Bot, error) {
+	res := make(map[int]*types.Bot, len(m.bots))
+	for id, bot := range m.bots {
+		b := *bot
+		res[id] = &b
+	}
+
+	return res, nil
+}
+
+func (m *botRegistryStoreMock) SelectActiveBotTokenAliases() ([]*types.BotTokenAlias, error) {
+	if m.beforeAliases != nil {
+		m.beforeAliases()
+	}
+
+	return m.aliases, nil
+}
+
+func (m *botRegistryStoreMock) SelectBotByToken(token string) (*types.Bot, error) {
+	m.queries++
+
+	for _, bot := range m.bots {
+		if bot.BotToken == token {
+			b := *bot
+			return &b, nil
+		}
+	}
+
+	for _, alias := range m.aliases {
+		if alias.BotToken == token && time.Now().Before(alias.ExpiresAt) {
+			b := *m.bots[alias.BotID]
+			return &b, nil
+		}
+	}
+
+	return nil, pgsql.ErrBotNotFound
+}
+
+func (m *botRegistryStoreMock) SelectBotByID(id int) (*types.Bot, error) {
+	m.queries++
+
+	bot, ok := m.bots[id]
+	if !ok {
+		return nil, pgsql.ErrBotNotFound
+	}
+
+	b := *bot
+
+	return &b, nil
+}
+
+func TestBotRegistryResolvesRotatedTokenAlias(t *testing.T) {
+	store := &botRegistryStoreMock{
+		bots: map[int]*types.Bot{
+			1: {ID: 1, BotToken: "new", Active: true},
+		},
+		aliases: []*types.BotTokenAlias{
+			{BotID: 1, BotToken: "old", ExpiresAt: time.Now().Add(time.Hour)},
+			{BotID: 1, BotToken: "expired", ExpiresAt: time.Now().Add(-time.Hour)},
+		},
+	}
+
+	r := newBotRegistry(store, true)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	bot, err := r.Get("old")
+	if err != nil {
+		t.Fatalf("Get(old) error = %v", err)
+	}
+
+	if bot.ID != 1 || bot.BotToken != "new" {
+		t.Fatalf("Get(old) = %+v, want bot 1 with the new token", bot)
+	}
+
+	if store.queries != 0 {
+		t.Fatalf("alias lookup queried the database %d times", store.queries)
+	}
+
+	if _, err := r.Get("expired"); err != pgsql.ErrBotNotFound {
+		t.Fatalf("Get(expired) error = %v, want %v", err, pgsql.ErrBotNotFound)
+	}
+}
+
+func TestBotRegistryInvalidateByAlias(t *testing.T) {
+	store := &botRegistryStoreMock{
+		bots: map[int]*types.Bot{
+			1: {ID: 1, BotToken: "new", Active: true},
+		},
+		aliases: []*types.BotTokenAlias{
+			{BotID: 1, BotToken: "old", ExpiresAt: time.Now().Add(time.Hour)},
+		},
+	}
+
+	r := newBotRegistry(store, true)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	store.bots[1].Active = false
+	r.Invalidate("old")
+
+	bot, err := r.Get("new")
+	if err != nil {
+		t.Fatalf("Get(new) error = %v", err)
+	}
+
+	if bot.Active || store.queries != 1 {
+		t.Fatalf("invalidated bot served from cache: active %v, %d queries", bot.Active, store.queries)
+	}
+}
+
+func TestBotRegistryReloadKeepsConcurrentInvalidation(t *testing.T) {
+	store := &botRegistryStoreMock{
+		bots: map[int]*types.Bot{
+			1: {ID: 1, BotToken: "token", Active: true},
+		},
+	}
+
+	r := newBotRegistry(store, true)
+
+	// the bot is deactivated after the reload read it as active
+	store.beforeAliases = func() {
+		store.bots[1].Active = false
+		r.Invalidate("token")
+	}
+
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	store.beforeAliases = nil
+
+	bot, err := r.Get("token")
+	if err != nil {
+		t.Fatalf("Get(token) error = %v", err)
+	}
+
+	if bot.Active {
+		t.Fatal("stale reload overwrote the invalidation")
+	}
+
+	// the bot read after the invalidation is cached again
+	if _, err := r.Get("token"); err != nil || store.queries != 1 {
+		t.Fatalf("Get(token) error = %v, %d queries, want 1", err, store.queries)
+	}
+}
+
+func TestBotRegistryReturnsCopies(t *testing.T) {
+	store := &botRegistryStoreMock{
+		bots: map[int]*types.Bot{
+			1: {ID: 1, BotToken: "token", Active: true},
+		},
+	}
+
+	r := newBotRegistry(store, true)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	bot, _ := r.Get("token")
+	bot.Active = false
+
+	if bot, _ := r.GetByID(1); !bot.Active {
+		t.Fatal("caller changes leaked into the registry")
+	}
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+type channelsMigrateRequest struct {
+	BotToken string `json:"bot_token"`
+
+	FromDepotChannelHash string `json:"from_depot_channel_hash"`
+	ToDepotChannelHash   string `json:"to_depot_channel_hash"`
+	ToTelegramChannelID  int64  `json:"to_telegram_channel_id"`
+	ToTelegramChannelURL string `json:"to_telegram_channel_url"`
+
+	// Percent of the source channel users matching the segment to move, all of them by default
+	Percent   float64                     `json:"percent"`
+	SegmentID int                         `json:"segment_id"`
+	Segment   *types.MailingSegmentFilter `json:"segment"`
+
+	DryRun bool `json:"dry_run"`
+}
+
+type channelsMigrateResponse struct {
+	Migration *types.ChannelMigration `json:"migration"`
+}
+
+func (req *channelsMigrateRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.FromDepotChannelHash == "" {
+		return errors.New("from_depot_channel_hash is empty")
+	}
+
+	if req.ToDepotChannelHash == "" {
+		return errors.New("to_depot_channel_hash is empty")
+	}
+
+	if req.ToTelegramChannelID == 0 {
+		return errors.New("to_telegram_channel_id is empty")
+	}
+
+	if req.ToTelegramChannelURL == "" {
+		return errors.New("to_telegram_channel_url is empty")
+	}
+
+	if req.FromDepotChannelHash == req.ToDepotChannelHash {
+		return errors.New("channels are the same")
+	}
+
+	if req.Percent == 0 {
+		req.Percent = 100
+	}
+
+	if req.Percent < 0 || req.Percent > 100 {
+		return errors.New("invalid percent")
+	}
+
+	return nil
+}
+
+func (s *Server) channelsMigrateHandler(c *fiber.Ctx) error {
+	req := &channelsMigrateRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	filter, err := s.resolveMailingSegment(bot.ID, req.SegmentID, req.Segment)
+	if err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	migration := &types.ChannelMigration{
+		BotID:                bot.ID,
+		FromDepotChannelHash: req.FromDepotChannelHash,
+		ToDepotChannelHash:   req.ToDepotChannelHash,
+		ToTelegramChannelID:  req.ToTelegramChannelID,
+		ToTelegramChannelURL: req.ToTelegramChannelURL,
+		Percent:              req.Percent,
+		Reason:               types.ChannelMigrationReasonManual,
+	}
+
+	if filter != nil {
+		migration.Segment = *filter
+	}
+
+	if err := s.deps.PG.MigrateUsersChannel(migration, req.DryRun); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&channelsMigrateResponse{
+		Migration: migration,
+	})
+}
+
+type channelsMigrationsListRequest struct {
+	BotToken string `json:"bot_token"`
+}
+
+type channelsMigrationsListResponse struct {
+	Migrations []*types.ChannelMigration `json:"migrations"`
+}
+
+func (s *Server) channelsMigrationsListHandler(c *fiber.Ctx) error {
+	req := &channelsMigrationsListRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if req.BotToken == "" {
+		return s.BadRequest(c, errors.New("bot_token is empty"))
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	migrations, err := s.deps.PG.SelectBotChannelMigrations(bot.ID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&channelsMigrationsListResponse{
+		Migrations: migrations,
+	})
+}
+
+type channelsMigrationsReportRequest struct {
+	BotToken    string `json:"bot_token"`
+	MigrationID int    `json:"migration_id"`
+}
+
+type channelsMigrationsReportResponse struct {
+	Migration *types.ChannelMigration       `json:"migration"`
+	Report    *types.ChannelMigrationReport `json:"report"`
+}
+
+func (req *channelsMigrationsReportRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.MigrationID == 0 {
+		return errors.New("migration_id is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) channelsMigrationsReportHandler(c *fiber.Ctx) error {
+	req := &channelsMigrationsReportRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	migration, err := s.deps.PG.SelectChannelMigration(req.MigrationID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if migration == nil || migration.BotID != bot.ID {
+		return s.BadRequest(c, errors.New("migration not found"))
+	}
+
+	report, err := s.deps.PG.SelectChannelMigrationReport(migration.ID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&channelsMigrationsReportResponse{
+		Migration: migration,
+		Report:    report,
+	})
+}
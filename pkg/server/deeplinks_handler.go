@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/prosperofair/stata/pkg/pgsql"
 	"github.com/prosperofair/stata/pkg/types"
 )
 
@@ -13,6 +14,8 @@ type DeeplinksCreateRequest struct {
 	ReferralTelegramID int64  `json:"referral_telegram_id"`
 	Label              string `json:"label"`
 	Hash               string `json:"hash,omitempty"`
+
+	deeplinksMetadata
 }
 
 type DeeplinksCreateResponse struct {
@@ -50,6 +53,7 @@ func (s *Server) DeeplinksCreateHandler(c *fiber.Ctx) error {
 		Hash:               types.GenerateDeeplinkHash(),
 		Label:              req.Label,
 	}
+	req.deeplinksMetadata.apply(deeplink)
 
 	if req.Hash != "" {
 		deeplinks, err := s.deps.PG.SelectBotDeeplinksByHash(bot.ID, req.Hash)
@@ -88,7 +92,8 @@ func (s *Server) DeeplinksCreateHandler(c *fiber.Ctx) error {
 }
 
 type DeeplinksListRequest struct {
-	BotToken string `json:"bot_token"`
+	BotToken        string `json:"bot_token"`
+	IncludeArchived bool   `json:"include_archived"`
 }
 
 type DeeplinksListResponse struct {
@@ -112,9 +117,19 @@ func (s *Server) DeeplinksListHandler(c *fiber.Ctx) error {
 		return s.InternalServerError(c, err)
 	}
 
-	return c.JSON(DeeplinksListResponse{
-		Deeplinks: deeplinks,
-	})
+	res := DeeplinksListResponse{
+		Deeplinks: make([]*types.Deeplink, 0, len(deeplinks)),
+	}
+
+	for _, deeplink := range deeplinks {
+		if deeplink.Archived && !req.IncludeArchived {
+			continue
+		}
+
+		res.Deeplinks = append(res.Deeplinks, deeplink)
+	}
+
+	return c.JSON(res)
 }
 
 type DeeplinksUpdateRequest struct {
@@ -152,3 +167,637 @@ func (s *Server) DeeplinksUpdateHandler(c *fiber.Ctx) error {
 
 	return s.ResponseOK(c)
 }
+
+type deeplinksHashRequest struct {
+	BotToken string `json:"bot_token"`
+	Hash     string `json:"hash"`
+}
+
+func (req *deeplinksHashRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.Hash == "" {
+		return errors.New("hash is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) deeplinksDeactivateHandler(c *fiber.Ctx) error {
+	return s.deeplinksUpdateActive(c, false)
+}
+
+func (s *Server) deeplinksReactivateHandler(c *fiber.Ctx) error {
+	return s.deeplinksUpdateActive(c, true)
+}
+
+func (s *Server) deeplinksUpdateActive(c *fiber.Ctx, active bool) error {
+	req := &deeplinksHashRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateDeeplinkActive(bot.ID, req.Hash, active); err != nil {
+		if errors.Is(err, pgsql.ErrDeeplinkNotFound) {
+			return s.BadRequest(c, err)
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	// the bot fallback deeplink policy may have been reset
+	if !active {
+		s.bots.Invalidate(bot.BotToken)
+	}
+
+	return s.ResponseOK(c)
+}
+
+func (s *Server) deeplinksDeleteHandler(c *fiber.Ctx) error {
+	req := &deeplinksHashRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if err := s.deps.PG.ArchiveDeeplink(bot.ID, req.Hash); err != nil {
+		if errors.Is(err, pgsql.ErrDeeplinkNotFound) {
+			return s.BadRequest(c, err)
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	// the bot fallback deeplink policy may have been reset
+	s.bots.Invalidate(bot.BotToken)
+
+	return s.ResponseOK(c)
+}
+
+type deeplinksMergeRequest struct {
+	BotToken  string `json:"bot_token"`
+	FromLabel string `json:"from_label"`
+	ToLabel   string `json:"to_label"`
+}
+
+type deeplinksMergeResponse struct {
+	Merge *types.DeeplinkLabelMerge `json:"merge"`
+}
+
+func (req *deeplinksMergeRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.FromLabel == "" || req.ToLabel == "" {
+		return errors.New("invalid label")
+	}
+
+	if req.FromLabel == req.ToLabel {
+		return errors.New("labels are equal")
+	}
+
+	if req.FromLabel == types.DeeplinkLabelReferral || req.ToLabel == types.DeeplinkLabelReferral {
+		return errors.New("referral label can not be merged")
+	}
+
+	return nil
+}
+
+func (s *Server) deeplinksMergeHandler(c *fiber.Ctx) error {
+	req := &deeplinksMergeRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	merge, err := s.deps.PG.MergeDeeplinkLabels(bot.ID, req.FromLabel, req.ToLabel)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&deeplinksMergeResponse{
+		Merge: merge,
+	})
+}
+
+type deeplinksSetInactivePolicyRequest struct {
+	BotToken     string `json:"bot_token"`
+	Policy       string `json:"policy"`
+	FallbackHash string `json:"fallback_hash"`
+}
+
+func (req *deeplinksSetInactivePolicyRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	switch req.Policy {
+	case types.DeeplinkInactivePolicyNone:
+	case types.DeeplinkInactivePolicyFallback:
+		if req.FallbackHash == "" {
+			return errors.New("fallback_hash is empty")
+		}
+	default:
+		return errors.New("invalid policy")
+	}
+
+	return nil
+}
+
+func (s *Server) deeplinksSetInactivePolicyHandler(c *fiber.Ctx) error {
+	req := &deeplinksSetInactivePolicyRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	fallbackID := 0
+	if req.Policy == types.DeeplinkInactivePolicyFallback {
+		deeplinks, err := s.deps.PG.SelectBotDeeplinksByHash(bot.ID, req.FallbackHash)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		if len(deeplinks) == 0 || !deeplinks[0].Active {
+			return s.BadRequest(c, errors.New("fallback deeplink not found or inactive"))
+		}
+
+		fallbackID = deeplinks[0].ID
+	}
+
+	if err := s.deps.PG.UpdateBotInactiveDeeplinkPolicy(bot.ID, req.Policy, fallbackID); err != nil {
+		return s.botError(c, err)
+	}
+
+	s.bots.Invalidate(bot.BotToken)
+
+	return s.ResponseOK(c)
+}
+
+// attributedDeeplinkID returns the deeplink a new user is attributed to,
+// inactive deeplinks are replaced according to the bot policy.
+func (s *Server) attributedDeeplinkID(bot *types.Bot, deeplink *types.Deeplink) int {
+	if deeplink.Active {
+		return deeplink.ID
+	}
+
+	if bot.InactiveDeeplinkPolicy == types.DeeplinkInactivePolicyFallback {
+		return bot.FallbackDeeplinkID
+	}
+
+	return 0
+}
+
+type deeplinksMetadata struct {
+	Source   string   `json:"source"`
+	Campaign string   `json:"campaign"`
+	AdSet    string   `json:"ad_set"`
+	Creative string   `json:"creative"`
+	Buyer    string   `json:"buyer"`
+	Tags     []string `json:"tags"`
+}
+
+func (m *deeplinksMetadata) apply(deeplink *types.Deeplink) {
+	deeplink.Source = m.Source
+	deeplink.Campaign = m.Campaign
+	deeplink.AdSet = m.AdSet
+	deeplink.Creative = m.Creative
+	deeplink.Buyer = m.Buyer
+	deeplink.Tags = m.Tags
+}
+
+type deeplinksUpdateMetadataRequest struct {
+	BotToken string `json:"bot_token"`
+	Hash     string `json:"hash"`
+
+	deeplinksMetadata
+}
+
+func (req *deeplinksUpdateMetadataRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.Hash == "" {
+		return errors.New("hash is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) deeplinksUpdateMetadataHandler(c *fiber.Ctx) error {
+	req := &deeplinksUpdateMetadataRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	deeplink := &types.Deeplink{}
+	req.deeplinksMetadata.apply(deeplink)
+
+	if err := s.deps.PG.UpdateDeeplinkMetadata(bot.ID, req.Hash, deeplink); err != nil {
+		if errors.Is(err, pgsql.ErrDeeplinkNotFound) {
+			return s.BadRequest(c, err)
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	return s.ResponseOK(c)
+}
+
+type deeplinksFBToolLinkRequest struct {
+	BotToken        string `json:"bot_token"`
+	Hash            string `json:"hash"`
+	FBToolAccountID int    `json:"fbtool_account_id"`
+	CampaignID      string `json:"campaign_id"`
+
+	// Share is the percentage of spend attributed to the deeplink, 100 when omitted
+	Share float64 `json:"share"`
+}
+
+type deeplinksFBToolLinkResponse struct {
+	Link *types.DeeplinkFBToolLink `json:"link"`
+}
+
+func (req *deeplinksFBToolLinkRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.Hash == "" {
+		return errors.New("hash is empty")
+	}
+
+	if req.FBToolAccountID == 0 {
+		return errors.New("fbtool_account_id is empty")
+	}
+
+	if req.Share == 0 {
+		req.Share = 100
+	}
+
+	if req.Share < 0 || req.Share > 100 {
+		return errors.New("invalid share")
+	}
+
+	return nil
+}
+
+// deeplinksFBToolLinkHandler maps the deeplink to an fbtool account or one of its campaigns,
+// mapped deeplinks no longer rely on the label matching the account name. Linking the same
+// target again updates its share, shares of one account can not exceed 100 percent in total.
+func (s *Server) deeplinksFBToolLinkHandler(c *fiber.Ctx) error {
+	req := &deeplinksFBToolLinkRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	deeplinks, err := s.deps.PG.SelectBotDeeplinksByHash(bot.ID, req.Hash)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if len(deeplinks) == 0 {
+		return s.BadRequest(c, errors.New("deeplink not found"))
+	}
+
+	link := &types.DeeplinkFBToolLink{
+		DeeplinkID:      deeplinks[0].ID,
+		FBToolAccountID: req.FBToolAccountID,
+		CampaignID:      req.CampaignID,
+		Share:           req.Share,
+	}
+
+	if err := s.deps.PG.UpsertDeeplinkFBToolLink(link); err != nil {
+		var shareErr *types.DeeplinkFBToolLinkShareError
+		if errors.As(err, &shareErr) || errors.Is(err, pgsql.ErrFBToolAccountNotFound) {
+			return s.BadRequest(c, err)
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&deeplinksFBToolLinkResponse{
+		Link: link,
+	})
+}
+
+type deeplinksFBToolLinksListRequest struct {
+	BotToken string `json:"bot_token"`
+}
+
+type deeplinksFBToolLinksListResponse struct {
+	Links []*types.DeeplinkFBToolLink `json:"links"`
+}
+
+func (req *deeplinksFBToolLinksListRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) deeplinksFBToolLinksListHandler(c *fiber.Ctx) error {
+	req := &deeplinksFBToolLinksListRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	links, err := s.deps.PG.SelectBotDeeplinkFBToolLinks(bot.ID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&deeplinksFBToolLinksListResponse{
+		Links: links,
+	})
+}
+
+type deeplinksFBToolLinksDeleteRequest struct {
+	BotToken string `json:"bot_token"`
+	ID       int    `json:"id"`
+}
+
+func (req *deeplinksFBToolLinksDeleteRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.ID == 0 {
+		return errors.New("id is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) deeplinksFBToolLinksDeleteHandler(c *fiber.Ctx) error {
+	req := &deeplinksFBToolLinksDeleteRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if err := s.deps.PG.DeleteDeeplinkFBToolLink(bot.ID, req.ID); err != nil {
+		if errors.Is(err, pgsql.ErrDeeplinkFBToolLinkNotFound) {
+			return s.BadRequest(c, err)
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	return s.ResponseOK(c)
+}
+
+const (
+	deeplinksBulkMaxCount    = 1000
+	deeplinksBulkMaxAttempts = 5
+
+	// qr codes are rendered in the request, so they are limited to smaller batches
+	deeplinksBulkQRMaxCount = 100
+	deeplinksBulkQRMaxSize  = 512
+)
+
+type deeplinksCreateBulkRequest struct {
+	BotToken string `json:"bot_token"`
+	Label    string `json:"label"`
+	Count    int    `json:"count"`
+
+	// QR is the optional qr code format of every link, png or svg
+	QR     string `json:"qr"`
+	QRSize int    `json:"qr_size"`
+
+	deeplinksMetadata
+}
+
+type deeplinksCreateBulkLink struct {
+	Hash string `json:"hash"`
+	URL  string `json:"url"`
+	QR   string `json:"qr,omitempty"`
+}
+
+type deeplinksCreateBulkResponse struct {
+	Links []*deeplinksCreateBulkLink `json:"links"`
+}
+
+func (req *deeplinksCreateBulkRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.Label == "" || req.Label == types.DeeplinkLabelReferral {
+		return errors.New("invalid label")
+	}
+
+	if req.Count <= 0 || req.Count > deeplinksBulkMaxCount {
+		return fmt.Errorf("count must be between 1 and %d", deeplinksBulkMaxCount)
+	}
+
+	switch req.QR {
+	case "", qrFormatPNG, qrFormatSVG:
+	default:
+		return errors.New("invalid qr format")
+	}
+
+	if req.QRSize == 0 {
+		req.QRSize = qrDefaultSize
+	}
+
+	if req.QRSize < 0 || req.QRSize > qrMaxSize {
+		return errors.New("invalid qr_size")
+	}
+
+	if req.QR != "" {
+		if req.Count > deeplinksBulkQRMaxCount {
+			return fmt.Errorf("qr codes are rendered for up to %d links", deeplinksBulkQRMaxCount)
+		}
+
+		if req.QRSize > deeplinksBulkQRMaxSize {
+			return fmt.Errorf("qr_size must not exceed %d for bulk links", deeplinksBulkQRMaxSize)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) deeplinksCreateBulkHandler(c *fiber.Ctx) error {
+	req := &deeplinksCreateBulkRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if bot.BotUsername == "" {
+		return s.BadRequest(c, errors.New("bot username is unknown"))
+	}
+
+	deeplinks, err := s.createBulkDeeplinks(bot.ID, req)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	res := &deeplinksCreateBulkResponse{
+		Links: make([]*deeplinksCreateBulkLink, 0, len(deeplinks)),
+	}
+
+	for _, deeplink := range deeplinks {
+		link := &deeplinksCreateBulkLink{
+			Hash: deeplink.Hash,
+			URL:  types.DeeplinkURL(bot.BotUsername, deeplink.Hash),
+		}
+
+		if req.QR != "" {
+			if link.QR, err = renderQR(link.URL, req.QR, req.QRSize); err != nil {
+				return s.InternalServerError(c, err)
+			}
+		}
+
+		res.Links = append(res.Links, link)
+	}
+
+	return c.JSON(res)
+}
+
+// createBulkDeeplinks inserts the requested number of deeplinks with random hashes,
+// the batch is generated again when a concurrent request takes one of its hashes.
+func (s *Server) createBulkDeeplinks(botID int, req *deeplinksCreateBulkRequest) ([]*types.Deeplink, error) {
+	for attempt := 0; attempt < deeplinksBulkMaxAttempts; attempt++ {
+		hashes, err := s.generateDeeplinkHashes(botID, req.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		deeplinks := make([]*types.Deeplink, 0, len(hashes))
+		for _, hash := range hashes {
+			deeplink := &types.Deeplink{
+				BotID: botID,
+				Hash:  hash,
+				Label: req.Label,
+			}
+			req.deeplinksMetadata.apply(deeplink)
+
+			deeplinks = append(deeplinks, deeplink)
+		}
+
+		if err := s.deps.PG.CreateDeeplinks(deeplinks); err != nil {
+			if errors.Is(err, pgsql.ErrAlreadyExists) {
+				continue
+			}
+			return nil, err
+		}
+
+		return deeplinks, nil
+	}
+
+	return nil, errors.New("failed to create deeplinks with unique hashes")
+}
+
+// generateDeeplinkHashes returns count random hashes which are not used by the bot yet.
+func (s *Server) generateDeeplinkHashes(botID, count int) ([]string, error) {
+	res := make([]string, 0, count)
+	unique := make(map[string]struct{}, count)
+
+	for attempt := 0; attempt < deeplinksBulkMaxAttempts; attempt++ {
+		candidates := make([]string, 0, count-len(res))
+		for len(candidates) < count-len(res) {
+			hash := types.GenerateDeeplinkHash()
+			if _, ok := unique[hash]; ok {
+				continue
+			}
+
+			unique[hash] = struct{}{}
+			candidates = append(candidates, hash)
+		}
+
+		existing, err := s.deps.PG.SelectBotExistingDeeplinkHashes(botID, candidates)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hash := range candidates {
+			if _, ok := existing[hash]; !ok {
+				res = append(res, hash)
+			}
+		}
+
+		if len(res) == count {
+			return res, nil
+		}
+	}
+
+	return nil, errors.New("failed to generate unique deeplink hashes")
+}
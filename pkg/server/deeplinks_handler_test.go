@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestDeeplinksCreateBulkRequestValidateQRCaps(t *testing.T) {
+	for name, tc := range map[string]struct {
+		count  int
+		qr     string
+		qrSize int
+		valid  bool
+	}{
+		"max links without qr": {count: deeplinksBulkMaxCount, valid: true},
+		"max qr links":         {count: deeplinksBulkQRMaxCount, qr: qrFormatPNG, valid: true},
+		"too many qr links":    {count: deeplinksBulkQRMaxCount + 1, qr: qrFormatSVG, valid: false},
+		"max bulk qr size":     {count: 1, qr: qrFormatPNG, qrSize: deeplinksBulkQRMaxSize, valid: true},
+		"bulk qr size too big": {count: 1, qr: qrFormatPNG, qrSize: deeplinksBulkQRMaxSize + 1, valid: false},
+		"max size without qr":  {count: 1, qrSize: qrMaxSize, valid: true},
+		"default size":         {count: 1, qr: qrFormatPNG, valid: true},
+	} {
+		req := &deeplinksCreateBulkRequest{
+			BotToken: "token",
+			Label:    "label",
+			Count:    tc.count,
+			QR:       tc.qr,
+			QRSize:   tc.qrSize,
+		}
+
+		if err := req.validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: validate() = %v, want valid %v", name, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prosperofair/pkg/depot"
+	"github.com/prosperofair/pkg/log"
+	"go.uber.org/zap"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+const (
+	depotCircuitClosed = iota
+	depotCircuitOpen
+	depotCircuitHalfOpen
+
+	depotRefillBatch = 500
+)
+
+var errDepotCircuitOpen = errors.New("depot circuit is open")
+
+// depotChannelClient is the depot call the cache wraps.
+type depotChannelClient interface {
+	GetBotChannelByTDR(botToken string) (*depot.Channel, error)
+}
+
+type depotChannelEntry struct {
+	channel   *depot.Channel
+	expiresAt time.Time
+}
+
+// depotChannels caches bot channels returned by depot and stops calling depot once it fails
+// threshold times in a row. After the cooldown a single probe call decides whether to close the circuit.
+type depotChannels struct {
+	client depotChannelClient
+
+	ttl       time.Duration
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]*depotChannelEntry
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+func newDepotChannels(client depotChannelClient, ttl time.Duration, threshold int, cooldown time.Duration) *depotChannels {
+	return &depotChannels{
+		client:    client,
+		ttl:       ttl,
+		threshold: threshold,
+		cooldown:  cooldown,
+		entries:   make(map[string]*depotChannelEntry),
+	}
+}
+
+// Get returns the channel depot distributes the bot traffic to, nil channels are cached as well.
+func (d *depotChannels) Get(botToken string) (*depot.Channel, error) {
+	if channel, ok := d.cached(botToken); ok {
+		metricDepotCache.WithLabelValues("hit").Inc()
+		return channel, nil
+	}
+
+	metricDepotCache.WithLabelValues("miss").Inc()
+
+	if !d.allow() {
+		return nil, errDepotCircuitOpen
+	}
+
+	start := time.Now()
+	channel, err := d.client.GetBotChannelByTDR(botToken)
+	metricDepotLatency.Observe(time.Since(start).Seconds())
+
+	d.report(err)
+
+	if err != nil {
+		metricDepotErrors.Inc()
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.entries[botToken] = &depotChannelEntry{
+		channel:   channel,
+		expiresAt: time.Now().Add(d.ttl),
+	}
+	d.mu.Unlock()
+
+	return channel, nil
+}
+
+func (d *depotChannels) cached(botToken string) (*depot.Channel, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.entries[botToken]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(d.entries, botToken)
+		return nil, false
+	}
+
+	return entry.channel, true
+}
+
+func (d *depotChannels) allow() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch d.state {
+	case depotCircuitOpen:
+		if time.Since(d.openedAt) < d.cooldown {
+			return false
+		}
+
+		d.setState(depotCircuitHalfOpen)
+		return true
+	case depotCircuitHalfOpen:
+		// the probe is already in flight
+		return false
+	default:
+		return true
+	}
+}
+
+func (d *depotChannels) report(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err == nil {
+		d.failures = 0
+		d.setState(depotCircuitClosed)
+		return
+	}
+
+	d.failures++
+
+	if d.state == depotCircuitHalfOpen || d.failures >= d.threshold {
+		if d.state != depotCircuitOpen {
+			log.Error("depot circuit opened", zap.Int("failures", d.failures), zap.Error(err))
+		}
+
+		d.openedAt = time.Now()
+		d.setState(depotCircuitOpen)
+	}
+}
+
+func (d *depotChannels) setState(state int) {
+	d.state = state
+	metricDepotCircuitState.Set(float64(state))
+}
+
+// runDepotRefill periodically assigns channels to users left without one while depot was unavailable.
+// Every tick handles the next batch, users depot has no channel for don't hold the batch back.
+// Depot calls go through the circuit, so the refill probes depot after the cooldown even without traffic.
+func (s *Server) runDepotRefill(interval time.Duration) {
+	cursor := 0
+
+	for range time.Tick(interval) {
+		next, err := s.refillUsersChannels(cursor)
+		if err != nil {
+			log.Error("failed to refill users channels", zap.Error(err))
+			continue
+		}
+
+		cursor = next
+	}
+}
+
+// refillUsersChannels handles the batch of users older than the cursor and returns the cursor
+// of the next batch, zero starts over from the newest users. Users whose bot or channel can't be
+// resolved are skipped, while the circuit is open the batch stops and resumes from the same user.
+func (s *Server) refillUsersChannels(cursor int) (int, error) {
+	users, err := s.deps.PG.SelectUsersWithoutChannel(cursor, depotRefillBatch)
+	if err != nil {
+		return cursor, err
+	}
+
+	// bots are nil when they failed, their other users wait for the next pass
+	bots := make(map[int]*types.Bot)
+
+	for _, user := range users {
+		bot, ok := bots[user.BotID]
+		if !ok {
+			if bot, err = s.deps.PG.SelectBotByID(user.BotID); err != nil {
+				log.Error("failed to select refilled user bot",
+					zap.Int("user_id", user.ID), zap.Int("bot_id", user.BotID), zap.Error(err))
+			}
+
+			bots[user.BotID] = bot
+		}
+
+		if bot == nil {
+			continue
+		}
+
+		if err := s.setBotChannelToNewBotUser(bot, user); err != nil {
+			if errors.Is(err, errDepotCircuitOpen) {
+				return user.ID + 1, nil
+			}
+
+			log.Error("failed to refill user channel",
+				zap.Int("user_id", user.ID), zap.Int("bot_id", bot.ID), zap.Error(err))
+
+			bots[user.BotID] = nil
+			continue
+		}
+
+		if user.DepotChannelHash == "" {
+			continue
+		}
+
+		if err := s.deps.PG.UpdateUserChannel(user.ID, &types.UserChannel{
+			DepotChannelHash:   user.DepotChannelHash,
+			TelegramChannelID:  user.TelegramChannelID,
+			TelegramChannelURL: user.TelegramChannelURL,
+		}); err != nil {
+			return user.ID + 1, err
+		}
+
+		metricDepotRefilledUsers.Inc()
+	}
+
+	if len(users) < depotRefillBatch {
+		return 0, nil
+	}
+
+	return users[len(users)-1].ID, nil
+}
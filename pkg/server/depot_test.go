@@ -0,0 +1,112 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prosperofair/pkg/depot"
+)
+
+type depotChannelClientMock struct {
+	err   error
+	calls int
+}
+
+func (m *depotChannelClientMock) GetBotChannelByTDR(string) (*depot.Channel, error) {
+	m.calls++
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &depot.Channel{Hash: "hash"}, nil
+}
+
+func TestDepotChannelsOpensAfterThreshold(t *testing.T) {
+	client := &depotChannelClientMock{err: errors.New("depot is down")}
+	d := newDepotChannels(client, time.Minute, 2, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if _, err := d.Get("token"); !errors.Is(err, client.err) {
+			t.Fatalf("call %d: error = %v, want %v", i, err, client.err)
+		}
+	}
+
+	if _, err := d.Get("token"); !errors.Is(err, errDepotCircuitOpen) {
+		t.Fatalf("error = %v, want %v", err, errDepotCircuitOpen)
+	}
+
+	if client.calls != 2 {
+		t.Fatalf("depot called %d times, want 2", client.calls)
+	}
+}
+
+func TestDepotChannelsProbesAfterCooldown(t *testing.T) {
+	client := &depotChannelClientMock{err: errors.New("depot is down")}
+	d := newDepotChannels(client, time.Minute, 1, time.Hour)
+
+	if _, err := d.Get("token"); err == nil {
+		t.Fatal("expected depot error")
+	}
+
+	// the cooldown is over, the next call is the single probe
+	d.openedAt = time.Now().Add(-2 * time.Hour)
+
+	if _, err := d.Get("token"); !errors.Is(err, client.err) {
+		t.Fatalf("probe error = %v, want %v", err, client.err)
+	}
+
+	// a failed probe opens the circuit for another cooldown
+	if _, err := d.Get("token"); !errors.Is(err, errDepotCircuitOpen) {
+		t.Fatalf("error after failed probe = %v, want %v", err, errDepotCircuitOpen)
+	}
+
+	d.openedAt = time.Now().Add(-2 * time.Hour)
+	client.err = nil
+
+	if _, err := d.Get("token"); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+
+	if d.state != depotCircuitClosed || d.failures != 0 {
+		t.Fatalf("state = %d with %d failures after a successful probe, want closed", d.state, d.failures)
+	}
+
+	if client.calls != 3 {
+		t.Fatalf("depot called %d times, want 3", client.calls)
+	}
+}
+
+func TestDepotChannelsAllowsSingleProbe(t *testing.T) {
+	d := newDepotChannels(&depotChannelClientMock{}, time.Minute, 1, time.Hour)
+	d.state = depotCircuitOpen
+	d.openedAt = time.Now().Add(-2 * time.Hour)
+
+	if !d.allow() {
+		t.Fatal("probe is not allowed after the cooldown")
+	}
+
+	if d.allow() {
+		t.Fatal("second call is allowed while the probe is in flight")
+	}
+}
+
+func TestDepotChannelsServesCacheWhileOpen(t *testing.T) {
+	client := &depotChannelClientMock{}
+	d := newDepotChannels(client, time.Minute, 1, time.Hour)
+
+	if _, err := d.Get("token"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	client.err = errors.New("depot is down")
+	if _, err := d.Get("other"); err == nil {
+		t.Fatal("expected depot error")
+	}
+
+	channel, err := d.Get("token")
+	if err != nil || channel == nil || channel.Hash != "hash" {
+		t.Fatalf("Get() = %v, %v, want the cached channel", channel, err)
+	}
+}
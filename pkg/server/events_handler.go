@@ -11,6 +11,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/prosperofair/pkg/log"
+	"github.com/prosperofair/stata/pkg/pgsql"
 	"github.com/prosperofair/stata/pkg/types"
 )
 
@@ -47,12 +48,16 @@ func (s *Server) EventsSubmitUserRegisterHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	bot, err := s.bots.Get(req.BotToken)
 	if err != nil {
 		return s.InternalServerError(c,
 			fmt.Errorf("select bot by token: %w", err))
 	}
 
+	if !bot.Active {
+		return s.Forbidden(c, errBotInactive)
+	}
+
 	users, err := s.deps.PG.SelectBotUsersByTelegramID(bot.ID, req.TelegramID)
 	if err != nil {
 		return s.InternalServerError(c, err)
@@ -67,7 +72,7 @@ func (s *Server) EventsSubmitUserRegisterHandler(c *fiber.Ctx) error {
 	}
 
 	if len(deeplinks) > 0 {
-		deeplinkID = deeplinks[0].ID
+		deeplinkID = s.attributedDeeplinkID(bot, deeplinks[0])
 	}
 
 	inviteUUID := "00000000-0000-0000-0000-000000000000"
@@ -77,13 +82,24 @@ func (s *Server) EventsSubmitUserRegisterHandler(c *fiber.Ctx) error {
 		if uuidHash.String() != "00000000-0000-0000-0000-000000000000" {
 			pl, err := s.deps.PG.SelectPixelLink(uuidHash.String())
 			if err != nil {
-				log.Error("failed to select pixel link by hash", zap.String("hash", uuidHash.String()))
+				return s.InternalServerError(c, err)
 			}
 
 			if pl != nil {
 				sendFacebookEvent(pl)
-				deeplinkID = pl.DeeplinkID
+				deeplinkID = 0
 				inviteUUID = uuidHash.String()
+
+				if pl.DeeplinkID != 0 {
+					deeplink, err := s.deps.PG.SelectDeeplinkByID(pl.DeeplinkID)
+					if err != nil && !errors.Is(err, pgsql.ErrDeeplinkNotFound) {
+						return s.InternalServerError(c, err)
+					}
+
+					if deeplink != nil {
+						deeplinkID = s.attributedDeeplinkID(bot, deeplink)
+					}
+				}
 			}
 		}
 	}
@@ -95,6 +111,12 @@ func (s *Server) EventsSubmitUserRegisterHandler(c *fiber.Ctx) error {
 				return s.InternalServerError(c, err)
 			}
 		}
+
+		if deeplinkID != 0 {
+			if err := s.deps.PG.CreateDeeplinkTouch(user.ID, deeplinkID); err != nil {
+				return s.InternalServerError(c, err)
+			}
+		}
 	} else {
 		seenTimes, err := s.deps.PG.CountUsersByTelegramID(req.TelegramID)
 		if err != nil {
@@ -132,6 +154,12 @@ func (s *Server) EventsSubmitUserRegisterHandler(c *fiber.Ctx) error {
 		if err := s.deps.PG.CreateUser(user); err != nil {
 			return s.InternalServerError(c, err)
 		}
+
+		if deeplinkID != 0 {
+			if err := s.deps.PG.CreateDeeplinkTouch(user.ID, deeplinkID); err != nil {
+				return s.InternalServerError(c, err)
+			}
+		}
 	}
 
 	return s.ResponseOK(c)
@@ -170,12 +198,16 @@ func (s *Server) EventsSubmitMessageHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	bot, err := s.bots.Get(req.BotToken)
 	if err != nil {
 		return s.InternalServerError(c,
 			fmt.Errorf("select bot by token: %w", err))
 	}
 
+	if !bot.Active {
+		return s.Forbidden(c, errBotInactive)
+	}
+
 	metricsEvents.WithLabelValues(bot.BotToken, types.EventTypeMessage).Inc()
 
 	users, err := s.deps.PG.SelectBotUsersByTelegramID(bot.ID, req.TelegramID)
@@ -270,12 +302,16 @@ func (s *Server) EventsSubmitLaunchHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	bot, err := s.bots.Get(req.BotToken)
 	if err != nil {
 		return s.InternalServerError(c,
 			fmt.Errorf("select bot by token: %w", err))
 	}
 
+	if !bot.Active {
+		return s.Forbidden(c, errBotInactive)
+	}
+
 	metricsEvents.WithLabelValues(bot.BotToken, types.EventTypeLaunch).Inc()
 
 	users, err := s.deps.PG.SelectBotUsersByTelegramID(bot.ID, req.TelegramID)
@@ -288,6 +324,15 @@ func (s *Server) EventsSubmitLaunchHandler(c *fiber.Ctx) error {
 			return s.InternalServerError(c, err)
 		}
 
+		// launches are logged to attribute them to mailing campaigns
+		if err := s.deps.PG.CreateEventLog(&types.EventsLog{
+			EventType:          types.EventTypeLaunch,
+			ReporterTelegramID: req.TelegramID,
+			UserID:             users[0].ID,
+		}); err != nil {
+			return s.InternalServerError(c, err)
+		}
+
 		ipInfo := net.ParseIP(req.IP)
 		record, err := s.deps.GeoIP.Country(ipInfo)
 		if err != nil {
@@ -338,6 +383,22 @@ func (s *Server) EventsSubmitDepositHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
+	user, err := s.deps.PG.SelectUserByID(req.UserID)
+	if err != nil {
+		return s.InternalServerError(c,
+			fmt.Errorf("select user by id: %w", err))
+	}
+
+	bot, err := s.bots.GetByID(user.BotID)
+	if err != nil {
+		return s.InternalServerError(c,
+			fmt.Errorf("select bot by id: %w", err))
+	}
+
+	if !bot.Active {
+		return s.Forbidden(c, errBotInactive)
+	}
+
 	el := &types.EventsLog{
 		EventType:          types.EventTypeDeposit,
 		ReporterTelegramID: req.ReporterTelegramID,
@@ -356,7 +417,7 @@ func (s *Server) EventsSubmitDepositHandler(c *fiber.Ctx) error {
 }
 
 func (s *Server) setBotChannelToNewBotUser(bot *types.Bot, user *types.User) error {
-	channel, err := s.deps.Depot.GetBotChannelByTDR(bot.BotToken)
+	channel, err := s.depot.Get(bot.BotToken)
 	if err != nil {
 		return fmt.Errorf("failed to list bot active channels: %w", err)
 	}
@@ -369,7 +430,29 @@ func (s *Server) setBotChannelToNewBotUser(bot *types.Bot, user *types.User) err
 		user.TelegramChannelURL = channel.TelegramChannelURL
 	}
 
-	if bot.Binding {
+	if !bot.Binding {
+		return nil
+	}
+
+	group, err := s.deps.PG.SelectTraceGroup(bot.TraceUUID)
+	if err != nil {
+		return fmt.Errorf("failed to get trace group: %w", err)
+	}
+
+	// bots bound by a bare trace uuid keep inheriting the channel of the oldest user
+	policy := types.TraceGroupBindingPolicyOldestUser
+	if group != nil {
+		policy = group.BindingPolicy
+	}
+
+	switch policy {
+	case types.TraceGroupBindingPolicyDefaultChannel:
+		if group.TelegramChannelID != 0 {
+			user.DepotChannelHash = group.DepotChannelHash
+			user.TelegramChannelID = group.TelegramChannelID
+			user.TelegramChannelURL = group.TelegramChannelURL
+		}
+	case types.TraceGroupBindingPolicyOldestUser:
 		botIDs, err := s.deps.PG.SelectBotIDsByTraceUUID(bot.TraceUUID)
 		if err != nil {
 			return fmt.Errorf("failed to list bots by trace uuid: %w", err)
@@ -380,6 +463,11 @@ func (s *Server) setBotChannelToNewBotUser(bot *types.Bot, user *types.User) err
 			return fmt.Errorf("failed to list bots older users by telegram ID: %w", err)
 		}
 
+		// the refilled user may be the oldest one itself, only a channel the oldest user has is inherited
+		if oldestUser.ID == user.ID || oldestUser.DepotChannelHash == "" {
+			return nil
+		}
+
 		user.DepotChannelHash = oldestUser.DepotChannelHash
 		user.TelegramChannelID = oldestUser.TelegramChannelID
 		user.TelegramChannelURL = oldestUser.TelegramChannelURL
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/prosperofair/stata/pkg/expenses"
+	"github.com/prosperofair/stata/pkg/pgsql"
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+type expensesCreateRequest struct {
+	BotToken string `json:"bot_token"`
+	Label    string `json:"label"`
+	Source   string `json:"source"`
+
+	Date        string  `json:"date"`
+	Spend       float64 `json:"spend"`
+	Clicks      int     `json:"clicks"`
+	Impressions int     `json:"impressions"`
+}
+
+type expensesCreateResponse struct {
+	Expense *types.Expense `json:"expense"`
+}
+
+func (req *expensesCreateRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.Label == "" {
+		return errors.New("label is empty")
+	}
+
+	if utf8.RuneCountInString(req.Label) > types.ExpenseLabelMaxLength {
+		return errors.New("label is too long")
+	}
+
+	if req.Source == "" {
+		req.Source = types.ExpenseSourceManual
+	}
+
+	if utf8.RuneCountInString(req.Source) > types.ExpenseSourceMaxLength {
+		return errors.New("source is too long")
+	}
+
+	if _, err := time.Parse(time.DateOnly, req.Date); err != nil {
+		return errors.New("invalid date")
+	}
+
+	if req.Spend < 0 || req.Clicks < 0 || req.Impressions < 0 {
+		return errors.New("negative values are not allowed")
+	}
+
+	return nil
+}
+
+func (s *Server) expensesCreateHandler(c *fiber.Ctx) error {
+	req := &expensesCreateRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	date, _ := time.Parse(time.DateOnly, req.Date)
+
+	expense := &types.Expense{
+		BotID:       bot.ID,
+		Label:       req.Label,
+		Source:      req.Source,
+		Date:        date,
+		Spend:       req.Spend,
+		Clicks:      req.Clicks,
+		Impressions: req.Impressions,
+	}
+
+	if err := s.deps.PG.UpsertExpense(expense); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&expensesCreateResponse{
+		Expense: expense,
+	})
+}
+
+type expensesImportResponse struct {
+	Imported int `json:"imported"`
+
+	// Unmatched are imported expenses whose labels have no deeplink,
+	// their spend isn't attributed until a deeplink with the label is created
+	Unmatched []*types.Expense `json:"unmatched"`
+}
+
+// expensesImportHandler imports daily spend from a multipart csv file in one transaction,
+// see expenses.ParseCSV for the expected columns.
+func (s *Server) expensesImportHandler(c *fiber.Ctx) error {
+	botToken := c.FormValue("bot_token")
+	if botToken == "" {
+		return s.BadRequest(c, errors.New("bot_token is empty"))
+	}
+
+	source := c.FormValue("source", types.ExpenseSourceCSV)
+	if utf8.RuneCountInString(source) > types.ExpenseSourceMaxLength {
+		return s.BadRequest(c, errors.New("source is too long"))
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return s.BadRequest(c, fmt.Errorf("file is missing: %w", err))
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+	defer f.Close()
+
+	records, err := expenses.ParseCSV(f)
+	if err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(botToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	for _, expense := range records {
+		if expense.BotToken != "" && expense.BotToken != bot.BotToken {
+			return s.BadRequest(c, errors.New("csv contains expenses of another bot"))
+		}
+
+		if expense.Spend < 0 || expense.Clicks < 0 || expense.Impressions < 0 {
+			return s.BadRequest(c, errors.New("negative values are not allowed"))
+		}
+
+		if utf8.RuneCountInString(expense.Label) > types.ExpenseLabelMaxLength {
+			return s.BadRequest(c, fmt.Errorf("label %q is too long", expense.Label))
+		}
+
+		expense.BotID = bot.ID
+		expense.Source = source
+	}
+
+	if err := s.deps.PG.ImportExpenses(records); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	labels := make([]string, 0, len(records))
+	for _, expense := range records {
+		labels = append(labels, expense.Label)
+	}
+
+	unmatchedLabels, err := s.deps.PG.SelectBotLabelsWithoutDeeplinks(bot.ID, labels)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	unmatched := make([]*types.Expense, 0)
+	for _, expense := range records {
+		if _, ok := unmatchedLabels[expense.Label]; ok {
+			unmatched = append(unmatched, expense)
+		}
+	}
+
+	return c.JSON(&expensesImportResponse{
+		Imported:  len(records),
+		Unmatched: unmatched,
+	})
+}
+
+type expensesListResponse struct {
+	Expenses []*types.Expense `json:"expenses"`
+}
+
+func (s *Server) expensesListHandler(c *fiber.Ctx) error {
+	req := &dateRangeRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	expenses, err := s.deps.PG.SelectBotExpenses(bot.ID, req.Start, req.End)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&expensesListResponse{
+		Expenses: expenses,
+	})
+}
+
+type expensesDeleteRequest struct {
+	BotToken string `json:"bot_token"`
+	ID       int    `json:"id"`
+}
+
+func (req *expensesDeleteRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.ID == 0 {
+		return errors.New("id is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) expensesDeleteHandler(c *fiber.Ctx) error {
+	req := &expensesDeleteRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if err := s.deps.PG.DeleteExpense(bot.ID, req.ID); err != nil {
+		if errors.Is(err, pgsql.ErrExpenseNotFound) {
+			return s.BadRequest(c, err)
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	return s.ResponseOK(c)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+func TestExpensesCreateRequestValidateLengths(t *testing.T) {
+	for name, tc := range map[string]struct {
+		label  string
+		source string
+		valid  bool
+	}{
+		"max label":      {label: strings.Repeat("л", types.ExpenseLabelMaxLength), valid: true},
+		"long label":     {label: strings.Repeat("л", types.ExpenseLabelMaxLength+1), valid: false},
+		"default source": {label: "label", valid: true},
+		"max source":     {label: "label", source: strings.Repeat("s", types.ExpenseSourceMaxLength), valid: true},
+		"long source":    {label: "label", source: strings.Repeat("s", types.ExpenseSourceMaxLength+1), valid: false},
+		"empty label":    {valid: false},
+	} {
+		req := &expensesCreateRequest{
+			BotToken: "token",
+			Label:    tc.label,
+			Source:   tc.source,
+			Date:     "2024-01-02",
+		}
+
+		if err := req.validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: validate() = %v, want valid %v", name, err, tc.valid)
+		}
+	}
+}
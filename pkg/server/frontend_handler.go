@@ -2,6 +2,7 @@ package server
 
 import (
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -11,8 +12,13 @@ import (
 )
 
 type dateRangeRequest struct {
-	BotToken string `json:"bot_token"`
-	GroupBy  string `json:"group_by"`
+	BotToken    string `json:"bot_token"`
+	GroupBy     string `json:"group_by"`
+	Attribution string `json:"attribution"`
+
+	// GroupByField is the deeplink field by-campaign reports are grouped by,
+	// group_by keeps the period the frontend sends to every report
+	GroupByField string `json:"group_by_field"`
 
 	StartAt string    `json:"start_at"`
 	Start   time.Time `json:"-"`
@@ -57,6 +63,26 @@ func (req *dateRangeRequest) validate() error {
 	return nil
 }
 
+// deeplinkGroupBy returns the deeplink field by-campaign reports are grouped by,
+// a period in group_by falls back to the label.
+func (req *dateRangeRequest) deeplinkGroupBy() (string, error) {
+	groupBy := req.GroupByField
+	if groupBy == "" {
+		groupBy = req.GroupBy
+	}
+
+	switch groupBy {
+	case "", GroupByDay, GroupByWeek, GroupByMonth:
+		return types.DeeplinkGroupByLabel, nil
+	}
+
+	if _, ok := types.DeeplinkGroupByWhitelist[groupBy]; !ok {
+		return "", errors.New("invalid group_by_field")
+	}
+
+	return groupBy, nil
+}
+
 type conversionsByPeriodResponse struct {
 	Data []*types.ConversionRow `json:"data"`
 }
@@ -71,38 +97,55 @@ func (s *Server) conversionsByCampaignHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	groupBy, err := req.deeplinkGroupBy()
 	if err != nil {
-		return s.InternalServerError(c, err)
+		return s.BadRequest(c, err)
 	}
 
-	deeplinks, err := s.deps.PG.SelectBotDeeplinksByReferralID(bot.ID, 0, 0)
-	if err != nil {
-		return s.InternalServerError(c, err)
+	if req.Attribution == "" {
+		req.Attribution = types.AttributionModelFirstTouch
 	}
 
-	labels := make([]string, 0)
-	labels = append(labels, "referral")
+	if _, ok := types.AttributionModelWhitelist[req.Attribution]; !ok {
+		return s.BadRequest(c, errors.New("invalid attribution"))
+	}
 
-	for _, d := range deeplinks {
-		labels = append(labels, d.Label)
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
 	}
 
-	users, err := s.deps.PG.SelectBotUsersByDeeplinks(bot.ID, req.Start, req.End)
+	users, err := s.deps.PG.SelectBotUsersByDeeplinks(bot.ID, groupBy, req.Attribution, req.Start, req.End)
 	if err != nil {
 		return s.InternalServerError(c, err)
 	}
 
-	leads, err := s.deps.PG.SelectBotLeadsByDeeplinks(bot.ID, req.Start, req.End)
+	leads, err := s.deps.PG.SelectBotLeadsByDeeplinks(bot.ID, groupBy, req.Attribution, req.Start, req.End)
 	if err != nil {
 		return s.InternalServerError(c, err)
 	}
 
-	expenses, err := s.deps.PG.SelectBotExpensesByDeeplinks(bot.ID, req.Start, req.End)
+	expenses, err := s.deps.PG.SelectBotExpensesByDeeplinks(bot.ID, groupBy, req.Start, req.End)
 	if err != nil {
 		return s.InternalServerError(c, err)
 	}
 
+	labels := make([]string, 0)
+	if groupBy == types.DeeplinkGroupByLabel {
+		deeplinks, err := s.deps.PG.SelectBotDeeplinksByReferralID(bot.ID, 0, 0)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		labels = append(labels, "referral")
+
+		for _, d := range deeplinks {
+			labels = append(labels, d.Label)
+		}
+	} else {
+		labels = conversionGroups(users, leads, expenses)
+	}
+
 	res := &conversionsByPeriodResponse{
 		Data: make([]*types.ConversionRow, 0),
 	}
@@ -434,3 +477,24 @@ func (s *Server) metricsHandler(c *fiber.Ctx) error {
 
 	return c.JSON(res)
 }
+
+// conversionGroups returns sorted distinct group values found in any of the conversion rows.
+func conversionGroups(rows ...map[string]*types.ConversionRow) []string {
+	seen := make(map[string]struct{})
+	res := make([]string, 0)
+
+	for _, m := range rows {
+		for group := range m {
+			if _, ok := seen[group]; ok {
+				continue
+			}
+
+			seen[group] = struct{}{}
+			res = append(res, group)
+		}
+	}
+
+	sort.Strings(res)
+
+	return res
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+func TestDateRangeRequestDeeplinkGroupBy(t *testing.T) {
+	for _, tc := range []struct {
+		groupBy      string
+		groupByField string
+		want         string
+		valid        bool
+	}{
+		{want: types.DeeplinkGroupByLabel, valid: true},
+		{groupBy: GroupByDay, want: types.DeeplinkGroupByLabel, valid: true},
+		{groupBy: GroupByWeek, want: types.DeeplinkGroupByLabel, valid: true},
+		{groupBy: GroupByMonth, want: types.DeeplinkGroupByLabel, valid: true},
+		{groupBy: types.DeeplinkGroupByCampaign, want: types.DeeplinkGroupByCampaign, valid: true},
+		{groupBy: GroupByDay, groupByField: types.DeeplinkGroupByTag, want: types.DeeplinkGroupByTag, valid: true},
+		{groupBy: GroupByDay, groupByField: "year", valid: false},
+		{groupByField: "d.label", valid: false},
+	} {
+		req := &dateRangeRequest{
+			GroupBy:      tc.groupBy,
+			GroupByField: tc.groupByField,
+		}
+
+		got, err := req.deeplinkGroupBy()
+		if (err == nil) != tc.valid {
+			t.Errorf("group_by %q, group_by_field %q: err = %v, want valid %v", tc.groupBy, tc.groupByField, err, tc.valid)
+			continue
+		}
+
+		if got != tc.want {
+			t.Errorf("group_by %q, group_by_field %q: got %q, want %q", tc.groupBy, tc.groupByField, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,513 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+var errMailingCampaignNotFound = errors.New("mailing campaign not found")
+
+type mailingCampaignsCreateRequest struct {
+	BotToken         string `json:"bot_token"`
+	DepotChannelHash string `json:"depot_channel_hash"`
+	Name             string `json:"name"`
+	SegmentID        int    `json:"segment_id"`
+
+	Variants []*mailingCampaignsVariant `json:"variants"`
+}
+
+type mailingCampaignsVariant struct {
+	Name    string `json:"name"`
+	Weight  int    `json:"weight"`
+	Payload string `json:"payload"`
+}
+
+type mailingCampaignsCreateResponse struct {
+	Campaign *types.MailingCampaign          `json:"campaign"`
+	Variants []*types.MailingCampaignVariant `json:"variants"`
+}
+
+func (req *mailingCampaignsCreateRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.DepotChannelHash == "" {
+		return errors.New("depot_channel_hash is empty")
+	}
+
+	if req.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	names := make(map[string]struct{}, len(req.Variants))
+	for _, variant := range req.Variants {
+		if variant.Name == "" {
+			return errors.New("variant name is empty")
+		}
+
+		if _, ok := names[variant.Name]; ok {
+			return errors.New("variant names must be unique")
+		}
+		names[variant.Name] = struct{}{}
+
+		if variant.Weight <= 0 {
+			return errors.New("variant weight must be positive")
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) mailingCampaignsCreateHandler(c *fiber.Ctx) error {
+	req := &mailingCampaignsCreateRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if _, err := s.resolveMailingSegment(bot.ID, req.SegmentID, nil); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	campaign := &types.MailingCampaign{
+		BotID:            bot.ID,
+		DepotChannelHash: req.DepotChannelHash,
+		Name:             req.Name,
+		SegmentID:        req.SegmentID,
+	}
+
+	variants := make([]*types.MailingCampaignVariant, 0, len(req.Variants))
+	for _, variant := range req.Variants {
+		variants = append(variants, &types.MailingCampaignVariant{
+			Name:    variant.Name,
+			Weight:  variant.Weight,
+			Payload: variant.Payload,
+		})
+	}
+
+	if err := s.deps.PG.CreateMailingCampaign(campaign, variants); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&mailingCampaignsCreateResponse{
+		Campaign: campaign,
+		Variants: variants,
+	})
+}
+
+type mailingCampaignsLeaseRequest struct {
+	BotToken   string `json:"bot_token"`
+	CampaignID int    `json:"campaign_id"`
+	Limit      int    `json:"limit"`
+	TTL        int    `json:"ttl"`
+}
+
+type mailingCampaignsLeaseResponse struct {
+	Users []*types.User       `json:"users"`
+	Lease *types.MailingLease `json:"lease"`
+
+	// Variants maps telegram ids of leased users to the variant they should receive
+	Variants map[int64]*types.MailingCampaignVariant `json:"variants,omitempty"`
+}
+
+func (req *mailingCampaignsLeaseRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.CampaignID == 0 {
+		return errors.New("campaign_id is empty")
+	}
+
+	if req.Limit == 0 {
+		return errors.New("limit is empty")
+	}
+
+	if req.TTL < 0 || time.Duration(req.TTL)*time.Second > types.MailingLeaseMaxTTL {
+		return errors.New("invalid ttl")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingCampaignsLeaseHandler(c *fiber.Ctx) error {
+	req := &mailingCampaignsLeaseRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	campaign, err := s.selectBotMailingCampaign(req.BotToken, req.CampaignID)
+	if err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if campaign.State != types.MailingCampaignStateActive {
+		return s.BadRequest(c, errors.New("mailing campaign is finished"))
+	}
+
+	filter, err := s.resolveMailingSegment(campaign.BotID, campaign.SegmentID, nil)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	filter, windows, err := s.applyMailingPolicy(campaign.BotID, filter)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	lease := &types.MailingLease{
+		LeaseID:          uuid.New(),
+		BotID:            campaign.BotID,
+		DepotChannelHash: campaign.DepotChannelHash,
+		CampaignID:       campaign.ID,
+	}
+
+	users, assigned, err := s.deps.PG.LeaseMailingCampaignUsers(campaign, lease, mailingLeaseTTL(req.TTL), windows, filter, req.Limit)
+	if err != nil {
+		return s.mailingPolicyError(c, err)
+	}
+
+	return c.JSON(&mailingCampaignsLeaseResponse{
+		Users:    users,
+		Lease:    lease,
+		Variants: assigned,
+	})
+}
+
+type mailingCampaignsUpdateUserStateRequest struct {
+	BotToken   string    `json:"bot_token"`
+	CampaignID int       `json:"campaign_id"`
+	TelegramID int64     `json:"telegram_id"`
+	State      string    `json:"state"`
+	Error      string    `json:"error"`
+	LeaseID    uuid.UUID `json:"lease_id"`
+}
+
+func (req *mailingCampaignsUpdateUserStateRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.CampaignID == 0 {
+		return errors.New("campaign_id is empty")
+	}
+
+	if req.TelegramID == 0 {
+		return errors.New("telegram_id is empty")
+	}
+
+	if _, ok := mailingCampaignUserStates[req.State]; !ok {
+		return errors.New("invalid state")
+	}
+
+	if req.Error == "" {
+		switch req.State {
+		case types.MailingCampaignUserStateBlocked:
+			req.Error = types.MailingErrorReasonBotBlocked
+		case types.MailingCampaignUserStateFailed:
+			req.Error = types.MailingErrorReasonUnknown
+		}
+	}
+
+	req.Error = types.TruncateMailingError(req.Error, types.MailingCampaignUserErrorMaxLength)
+
+	return nil
+}
+
+// mailingCampaignUserStates maps campaign delivery outcomes to the user mailing state,
+// failures go through the blocked state so transient ones are counted towards the attempts limit.
+var mailingCampaignUserStates = map[string]string{
+	types.MailingCampaignUserStateSent:    types.UserMailingStateFinished,
+	types.MailingCampaignUserStateBlocked: types.UserMailingStateBlocked,
+	types.MailingCampaignUserStateFailed:  types.UserMailingStateBlocked,
+}
+
+func (s *Server) mailingCampaignsUpdateUserStateHandler(c *fiber.Ctx) error {
+	req := &mailingCampaignsUpdateUserStateRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	campaign, err := s.selectBotMailingCampaign(req.BotToken, req.CampaignID)
+	if err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := s.validateUserMailingLease(campaign.BotID, req.TelegramID, req.LeaseID); err != nil {
+		return s.mailingLeaseError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateMailingCampaignUserState(campaign.ID, campaign.BotID,
+		req.TelegramID, req.State, req.Error,
+	); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateBotUserMailingState(req.BotToken, req.TelegramID,
+		mailingCampaignUserStates[req.State],
+		types.TruncateMailingError(req.Error, types.MailingErrorReasonMaxLength),
+		campaign.ID,
+	); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return s.ResponseOK(c)
+}
+
+type mailingCampaignsFinishRequest struct {
+	BotToken   string `json:"bot_token"`
+	CampaignID int    `json:"campaign_id"`
+}
+
+func (req *mailingCampaignsFinishRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.CampaignID == 0 {
+		return errors.New("campaign_id is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingCampaignsFinishHandler(c *fiber.Ctx) error {
+	req := &mailingCampaignsFinishRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	campaign, err := s.selectBotMailingCampaign(req.BotToken, req.CampaignID)
+	if err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := s.deps.PG.FinishMailingCampaign(campaign.ID); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return s.ResponseOK(c)
+}
+
+type mailingCampaignsReportRequest struct {
+	BotToken   string `json:"bot_token"`
+	CampaignID int    `json:"campaign_id"`
+}
+
+type mailingCampaignsReportRow struct {
+	Campaign *types.MailingCampaign      `json:"campaign"`
+	Stats    *types.MailingCampaignStats `json:"stats"`
+	Duration float64                     `json:"duration"`
+}
+
+type mailingCampaignsReportResponse struct {
+	Data []*mailingCampaignsReportRow `json:"data"`
+}
+
+func (req *mailingCampaignsReportRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingCampaignsReportHandler(c *fiber.Ctx) error {
+	req := &mailingCampaignsReportRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	campaigns := make([]*types.MailingCampaign, 0)
+	if req.CampaignID != 0 {
+		campaign, err := s.selectBotMailingCampaign(req.BotToken, req.CampaignID)
+		if err != nil {
+			return s.BadRequest(c, err)
+		}
+
+		campaigns = append(campaigns, campaign)
+	} else {
+		bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		campaigns, err = s.deps.PG.SelectBotMailingCampaigns(bot.ID)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+	}
+
+	ids := make([]int, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		ids = append(ids, campaign.ID)
+	}
+
+	stats, err := s.deps.PG.SelectMailingCampaignsStats(ids)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	res := &mailingCampaignsReportResponse{
+		Data: make([]*mailingCampaignsReportRow, 0, len(campaigns)),
+	}
+
+	for _, campaign := range campaigns {
+		stat, ok := stats[campaign.ID]
+		if !ok {
+			stat = &types.MailingCampaignStats{CampaignID: campaign.ID}
+		}
+
+		res.Data = append(res.Data, &mailingCampaignsReportRow{
+			Campaign: campaign,
+			Stats:    stat,
+			Duration: campaign.Duration().Seconds(),
+		})
+	}
+
+	return c.JSON(res)
+}
+
+func (s *Server) selectBotMailingCampaign(botToken string, id int) (*types.MailingCampaign, error) {
+	bot, err := s.deps.PG.SelectBotByToken(botToken)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign, err := s.deps.PG.SelectMailingCampaign(id)
+	if err != nil {
+		return nil, errMailingCampaignNotFound
+	}
+
+	if campaign.BotID != bot.ID {
+		return nil, errMailingCampaignNotFound
+	}
+
+	return campaign, nil
+}
+
+type mailingCampaignsVariantsReportRequest struct {
+	BotToken   string `json:"bot_token"`
+	CampaignID int    `json:"campaign_id"`
+
+	// Window is the attribution window in hours
+	Window int `json:"window"`
+}
+
+type mailingCampaignsVariantsReportRow struct {
+	Variant *types.MailingCampaignVariant      `json:"variant"`
+	Stats   *types.MailingCampaignVariantStats `json:"stats"`
+}
+
+type mailingCampaignsVariantsReportResponse struct {
+	Campaign *types.MailingCampaign               `json:"campaign"`
+	Data     []*mailingCampaignsVariantsReportRow `json:"data"`
+}
+
+func (req *mailingCampaignsVariantsReportRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.CampaignID == 0 {
+		return errors.New("campaign_id is empty")
+	}
+
+	if req.Window < 0 {
+		return errors.New("invalid window")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingCampaignsVariantsReportHandler(c *fiber.Ctx) error {
+	req := &mailingCampaignsVariantsReportRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	campaign, err := s.selectBotMailingCampaign(req.BotToken, req.CampaignID)
+	if err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	window := types.MailingAttributionDefaultWindow
+	if req.Window > 0 {
+		window = time.Duration(req.Window) * time.Hour
+	}
+
+	variants, err := s.deps.PG.SelectMailingCampaignVariants(campaign.ID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	stats, err := s.deps.PG.SelectMailingCampaignVariantsStats(campaign.ID, window)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	statsByVariant := make(map[int]*types.MailingCampaignVariantStats, len(stats))
+	for _, stat := range stats {
+		statsByVariant[stat.VariantID] = stat
+	}
+
+	res := &mailingCampaignsVariantsReportResponse{
+		Campaign: campaign,
+		Data:     make([]*mailingCampaignsVariantsReportRow, 0, len(variants)),
+	}
+
+	for _, variant := range variants {
+		stat, ok := statsByVariant[variant.ID]
+		if !ok {
+			stat = &types.MailingCampaignVariantStats{VariantID: variant.ID}
+		}
+
+		res.Data = append(res.Data, &mailingCampaignsVariantsReportRow{
+			Variant: variant,
+			Stats:   stat,
+		})
+	}
+
+	// users leased before the variants were assigned
+	if stat, ok := statsByVariant[0]; ok {
+		res.Data = append(res.Data, &mailingCampaignsVariantsReportRow{
+			Stats: stat,
+		})
+	}
+
+	return c.JSON(res)
+}
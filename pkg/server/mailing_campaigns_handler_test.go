@@ -0,0 +1,17 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMailingCampaignsCreateHandlerRejectsZeroWeight(t *testing.T) {
+	body := `{"bot_token":"token","depot_channel_hash":"hash","name":"campaign","variants":[{"name":"a","weight":0}]}`
+
+	s := &Server{}
+
+	status := postJSON(t, s.mailingCampaignsCreateHandler, body)
+	if status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+const mailingDeliveriesDefaultLimit = 100
+
+type mailingDeliveriesListRequest struct {
+	BotToken   string `json:"bot_token"`
+	TelegramID int64  `json:"telegram_id"`
+	Limit      int    `json:"limit"`
+}
+
+type mailingDeliveriesListResponse struct {
+	User       *types.User              `json:"user"`
+	Deliveries []*types.MailingDelivery `json:"deliveries"`
+}
+
+func (req *mailingDeliveriesListRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.TelegramID == 0 {
+		return errors.New("telegram_id is empty")
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = mailingDeliveriesDefaultLimit
+	}
+
+	return nil
+}
+
+func (s *Server) mailingDeliveriesListHandler(c *fiber.Ctx) error {
+	req := &mailingDeliveriesListRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	users, err := s.deps.PG.SelectBotUsersByTelegramID(bot.ID, req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if len(users) == 0 {
+		return s.BadRequest(c, errors.New("user not found"))
+	}
+
+	deliveries, err := s.deps.PG.SelectUserMailingDeliveries(users[0].ID, req.Limit)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&mailingDeliveriesListResponse{
+		User:       users[0],
+		Deliveries: deliveries,
+	})
+}
+
+type statsMailingBlocksResponse struct {
+	Data []*types.MailingBlocksRow `json:"data"`
+}
+
+// statsMailingBlocksHandler reports how many users blocked and unblocked the bot over time.
+func (s *Server) statsMailingBlocksHandler(c *fiber.Ctx) error {
+	req := &dateRangeRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	switch req.GroupBy {
+	case "":
+		req.GroupBy = GroupByDay
+	case GroupByDay, GroupByWeek, GroupByMonth:
+	default:
+		return s.BadRequest(c, errors.New("invalid group_by"))
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	rows, err := s.deps.PG.SelectBotMailingBlocksByPeriod(bot.ID, req.GroupBy, req.Start, req.End)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&statsMailingBlocksResponse{
+		Data: rows,
+	})
+}
@@ -2,22 +2,46 @@ package server
 
 import (
 	"errors"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 
+	"github.com/prosperofair/stata/pkg/pgsql"
 	"github.com/prosperofair/stata/pkg/types"
 )
 
+var (
+	errMailingLeaseNotFound = errors.New("mailing lease not found")
+	errMailingLeaseExpired  = errors.New("mailing lease is expired")
+	errMailingLeaseMismatch = errors.New("user is not leased by lease_id")
+	errMailingLeaseRequired = errors.New("lease_id is required while the channel is leased")
+)
+
 type MailingPrepareUsersListRequest struct {
 	BotToken         string `json:"bot_token"`
 	DepotChannelHash string `json:"depot_channel_hash"`
 
 	Limit  int  `json:"limit"`
 	DryRun bool `json:"dry_run"`
+
+	// CountOnly turns dry run into a preview of the audience size
+	CountOnly bool `json:"count_only"`
+
+	// TTL is the lease duration in seconds
+	TTL int `json:"ttl"`
+
+	Segment   *types.MailingSegmentFilter `json:"segment"`
+	SegmentID int                         `json:"segment_id"`
 }
 
 type MailingPrepareUsersListResponse struct {
-	Users []*types.User `json:"users"`
+	Users []*types.User       `json:"users"`
+	Lease *types.MailingLease `json:"lease,omitempty"`
+	Count *int                `json:"count,omitempty"`
+
+	// Policy is returned by dry runs, the preview is narrowed by the bot mailing policy
+	Policy *mailingPolicyPreview `json:"policy,omitempty"`
 }
 
 func (req *MailingPrepareUsersListRequest) validate() error {
@@ -33,6 +57,18 @@ func (req *MailingPrepareUsersListRequest) validate() error {
 		return errors.New("limit is empty")
 	}
 
+	if req.TTL < 0 || time.Duration(req.TTL)*time.Second > types.MailingLeaseMaxTTL {
+		return errors.New("invalid ttl")
+	}
+
+	if req.CountOnly && !req.DryRun {
+		return errors.New("count_only requires dry_run")
+	}
+
+	if req.Segment != nil && req.SegmentID != 0 {
+		return errors.New("segment and segment_id are mutually exclusive")
+	}
+
 	return nil
 }
 
@@ -51,34 +87,73 @@ func (s *Server) MailingPrepareUsersListHandler(c *fiber.Ctx) error {
 		return s.InternalServerError(c, err)
 	}
 
-	users, err := s.deps.PG.SelectRandomReadyUsersByDepotChannelHash(bot.ID, req.DepotChannelHash, req.Limit)
+	filter, err := s.resolveMailingSegment(bot.ID, req.SegmentID, req.Segment)
 	if err != nil {
-		return s.InternalServerError(c, err)
+		return s.BadRequest(c, err)
 	}
 
-	res := &MailingPrepareUsersListResponse{
-		Users: users,
+	filter, windows, err := s.applyMailingPolicy(bot.ID, filter)
+	if err != nil {
+		return s.InternalServerError(c, err)
 	}
 
 	if req.DryRun {
-		return c.JSON(res)
+		limit, policy, err := s.previewMailingPolicy(bot.ID, req.Limit, filter, windows)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		if req.CountOnly {
+			count, err := s.deps.PG.CountReadyUsersByDepotChannelHash(bot.ID, req.DepotChannelHash, filter)
+			if err != nil {
+				return s.InternalServerError(c, err)
+			}
+
+			return c.JSON(&MailingPrepareUsersListResponse{
+				Users:  make([]*types.User, 0),
+				Count:  &count,
+				Policy: policy,
+			})
+		}
+
+		users := make([]*types.User, 0)
+		if !policy.Blocked {
+			if users, err = s.deps.PG.SelectRandomReadyUsersByDepotChannelHash(bot.ID, req.DepotChannelHash, filter, limit); err != nil {
+				return s.InternalServerError(c, err)
+			}
+		}
+
+		return c.JSON(&MailingPrepareUsersListResponse{
+			Users:  users,
+			Policy: policy,
+		})
 	}
 
-	ids := make([]int, 0)
-	for _, u := range users {
-		ids = append(ids, u.ID)
+	lease := &types.MailingLease{
+		LeaseID:          uuid.New(),
+		BotID:            bot.ID,
+		DepotChannelHash: req.DepotChannelHash,
 	}
-	if err := s.deps.PG.UpdateUsersMailingState(types.UserMailingStateInProgress, ids); err != nil {
-		return s.InternalServerError(c, err)
+
+	users, err := s.deps.PG.LeaseReadyUsersByDepotChannelHash(lease, mailingLeaseTTL(req.TTL), windows, filter, req.Limit)
+	if err != nil {
+		return s.mailingPolicyError(c, err)
 	}
 
-	return c.JSON(res)
+	return c.JSON(&MailingPrepareUsersListResponse{
+		Users: users,
+		Lease: lease,
+	})
 }
 
 type MailingUpdateUserStateRequest struct {
-	BotToken   string `json:"bot_token"`
-	TelegramID int64  `json:"telegram_id"`
-	State      string `json:"state"`
+	BotToken   string    `json:"bot_token"`
+	TelegramID int64     `json:"telegram_id"`
+	State      string    `json:"state"`
+	LeaseID    uuid.UUID `json:"lease_id"`
+
+	// Reason is the delivery error reason of blocked users, e.g. bot_blocked or flood_wait
+	Reason string `json:"reason"`
 }
 
 func (req *MailingUpdateUserStateRequest) validate() error {
@@ -101,6 +176,8 @@ func (req *MailingUpdateUserStateRequest) validate() error {
 		return errors.New("invalid state")
 	}
 
+	req.Reason = types.TruncateMailingError(req.Reason, types.MailingErrorReasonMaxLength)
+
 	return nil
 }
 
@@ -114,7 +191,16 @@ func (s *Server) MailingUpdateUserStateHandler(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	if err := s.deps.PG.UpdateBotUserMailingState(req.BotToken, req.TelegramID, req.State); err != nil {
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if err := s.validateUserMailingLease(bot.ID, req.TelegramID, req.LeaseID); err != nil {
+		return s.mailingLeaseError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateBotUserMailingState(req.BotToken, req.TelegramID, req.State, req.Reason, 0); err != nil {
 		return s.InternalServerError(c, err)
 	}
 
@@ -122,8 +208,13 @@ func (s *Server) MailingUpdateUserStateHandler(c *fiber.Ctx) error {
 }
 
 type MailingFinishUsersListRequest struct {
-	BotToken         string `json:"bot_token"`
-	DepotChannelHash string `json:"depot_channel_hash"`
+	BotToken         string    `json:"bot_token"`
+	DepotChannelHash string    `json:"depot_channel_hash"`
+	LeaseID          uuid.UUID `json:"lease_id"`
+}
+
+type MailingFinishUsersListResponse struct {
+	Released int `json:"released"`
 }
 
 func (req *MailingFinishUsersListRequest) validate() error {
@@ -131,7 +222,7 @@ func (req *MailingFinishUsersListRequest) validate() error {
 		return errors.New("bot_token is empty")
 	}
 
-	if req.DepotChannelHash == "" {
+	if req.DepotChannelHash == "" && req.LeaseID == uuid.Nil {
 		return errors.New("depot_channel_hash is empty")
 	}
 
@@ -153,9 +244,123 @@ func (s *Server) MailingFinishUsersListHandler(c *fiber.Ctx) error {
 		return s.InternalServerError(c, err)
 	}
 
+	// a lease only returns its own unprocessed users, finished users of the channel are kept
+	if req.LeaseID != uuid.Nil {
+		lease, err := s.mailingLease(bot.ID, req.LeaseID)
+		if err != nil {
+			return s.mailingLeaseError(c, err)
+		}
+
+		released, err := s.deps.PG.ReleaseMailingLease(lease.LeaseID)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		return c.JSON(&MailingFinishUsersListResponse{
+			Released: released,
+		})
+	}
+
+	// resetting the whole channel would return users held by another sender
+	leased, err := s.deps.PG.HasActiveMailingLeases(bot.ID, req.DepotChannelHash)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if leased {
+		return s.BadRequest(c, errMailingLeaseRequired)
+	}
+
 	if err := s.deps.PG.SetBotUsersMailingStatesReady(bot.ID, req.DepotChannelHash); err != nil {
 		return s.InternalServerError(c, err)
 	}
 
 	return s.ResponseOK(c)
 }
+
+// validateUserMailingLease checks the user is held by the lease. Updates without a lease are only
+// accepted for users which are not held by an active lease of another sender.
+func (s *Server) validateUserMailingLease(botID int, telegramID int64, leaseID uuid.UUID) error {
+	users, err := s.deps.PG.SelectBotUsersByTelegramID(botID, telegramID)
+	if err != nil {
+		return err
+	}
+
+	if leaseID == uuid.Nil {
+		if len(users) == 0 || users[0].MailingLeaseID == uuid.Nil {
+			return nil
+		}
+
+		lease, err := s.deps.PG.SelectMailingLease(users[0].MailingLeaseID)
+		if errors.Is(err, pgsql.ErrMailingLeaseNotFound) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if lease.Expired() {
+			return nil
+		}
+
+		return errMailingLeaseRequired
+	}
+
+	lease, err := s.mailingLease(botID, leaseID)
+	if err != nil {
+		return err
+	}
+
+	if lease.Expired() {
+		return errMailingLeaseExpired
+	}
+
+	if len(users) == 0 || users[0].MailingLeaseID != leaseID {
+		return errMailingLeaseMismatch
+	}
+
+	return nil
+}
+
+// mailingLease returns the lease of the bot, leases of other bots are not found.
+func (s *Server) mailingLease(botID int, leaseID uuid.UUID) (*types.MailingLease, error) {
+	lease, err := s.deps.PG.SelectMailingLease(leaseID)
+	if errors.Is(err, pgsql.ErrMailingLeaseNotFound) {
+		return nil, errMailingLeaseNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lease.BotID != botID {
+		return nil, errMailingLeaseNotFound
+	}
+
+	return lease, nil
+}
+
+// mailingLeaseError responds with bad request to lease violations and with internal error otherwise.
+func (s *Server) mailingLeaseError(c *fiber.Ctx, err error) error {
+	for _, leaseErr := range []error{
+		errMailingLeaseNotFound,
+		errMailingLeaseExpired,
+		errMailingLeaseMismatch,
+		errMailingLeaseRequired,
+	} {
+		if errors.Is(err, leaseErr) {
+			return s.BadRequest(c, err)
+		}
+	}
+
+	return s.InternalServerError(c, err)
+}
+
+func mailingLeaseTTL(seconds int) time.Duration {
+	if seconds == 0 {
+		return types.MailingLeaseDefaultTTL
+	}
+
+	return time.Duration(seconds) * time.Second
+}
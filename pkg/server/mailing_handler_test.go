@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMailingLeaseErrorStatus(t *testing.T) {
+	s := &Server{}
+
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{err: errMailingLeaseNotFound, status: http.StatusBadRequest},
+		{err: errMailingLeaseExpired, status: http.StatusBadRequest},
+		{err: errMailingLeaseMismatch, status: http.StatusBadRequest},
+		{err: errMailingLeaseRequired, status: http.StatusBadRequest},
+		{err: fmt.Errorf("failed to select mailing lease: %w", errors.New("connection refused")), status: http.StatusInternalServerError},
+	} {
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			return s.mailingLeaseError(c, tc.err)
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.status {
+			t.Errorf("%v: status = %d, want %d", tc.err, resp.StatusCode, tc.status)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+// mailingPolicyPreview tells dry runs whether the policy would let the batch be sent right now.
+type mailingPolicyPreview struct {
+	Blocked    bool `json:"blocked"`
+	RetryAfter int  `json:"retry_after,omitempty"`
+}
+
+type mailingPoliciesSetRequest struct {
+	BotToken string `json:"bot_token"`
+
+	MaxPerSecond int `json:"max_per_second"`
+	MaxPerMinute int `json:"max_per_minute"`
+
+	QuietHoursStart int    `json:"quiet_hours_start"`
+	QuietHoursEnd   int    `json:"quiet_hours_end"`
+	DefaultTimezone string `json:"default_timezone"`
+
+	MinGap int `json:"min_gap"`
+}
+
+type mailingPoliciesResponse struct {
+	Policy *types.MailingPolicy `json:"policy"`
+}
+
+func (req *mailingPoliciesSetRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.MaxPerSecond < 0 || req.MaxPerMinute < 0 {
+		return errors.New("invalid rate limit")
+	}
+
+	if req.QuietHoursStart < 0 || req.QuietHoursStart > 23 || req.QuietHoursEnd < 0 || req.QuietHoursEnd > 23 {
+		return errors.New("invalid quiet hours")
+	}
+
+	if req.DefaultTimezone == "" {
+		req.DefaultTimezone = "UTC"
+	}
+
+	if _, err := time.LoadLocation(req.DefaultTimezone); err != nil {
+		return errors.New("invalid default_timezone")
+	}
+
+	if req.MinGap < 0 {
+		return errors.New("invalid min_gap")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingPoliciesSetHandler(c *fiber.Ctx) error {
+	req := &mailingPoliciesSetRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	policy := &types.MailingPolicy{
+		BotID:           bot.ID,
+		MaxPerSecond:    req.MaxPerSecond,
+		MaxPerMinute:    req.MaxPerMinute,
+		QuietHoursStart: req.QuietHoursStart,
+		QuietHoursEnd:   req.QuietHoursEnd,
+		DefaultTimezone: req.DefaultTimezone,
+		MinGap:          req.MinGap,
+	}
+
+	if err := s.deps.PG.UpsertMailingPolicy(policy); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&mailingPoliciesResponse{
+		Policy: policy,
+	})
+}
+
+type mailingPoliciesGetRequest struct {
+	BotToken string `json:"bot_token"`
+}
+
+func (s *Server) mailingPoliciesGetHandler(c *fiber.Ctx) error {
+	req := &mailingPoliciesGetRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if req.BotToken == "" {
+		return s.BadRequest(c, errors.New("bot_token is empty"))
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	policy, err := s.deps.PG.SelectBotMailingPolicy(bot.ID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&mailingPoliciesResponse{
+		Policy: policy,
+	})
+}
+
+// applyMailingPolicy narrows the filter to users which are outside of quiet hours and were not mailed
+// recently and returns the bot rate limits, which cap the batch size when users are leased.
+// Bots without a policy are not restricted.
+func (s *Server) applyMailingPolicy(botID int, filter *types.MailingSegmentFilter) (*types.MailingSegmentFilter, []types.MailingRateWindow, error) {
+	policy, err := s.deps.PG.SelectBotMailingPolicy(botID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if policy == nil {
+		return filter, nil, nil
+	}
+
+	res := &types.MailingSegmentFilter{}
+	if filter != nil {
+		*res = *filter
+	}
+
+	now := time.Now()
+
+	if policy.MinGap > 0 {
+		before := now.Add(-time.Duration(policy.MinGap) * time.Second)
+		res.MailedBefore = &before
+	}
+
+	if policy.QuietHoursStart != policy.QuietHoursEnd {
+		quiet, awake := make([]string, 0), make([]string, 0)
+		for country, timezone := range types.CountryTimezones {
+			if policy.IsQuietHour(types.LocalHour(now, timezone)) {
+				quiet = append(quiet, country)
+			} else {
+				awake = append(awake, country)
+			}
+		}
+
+		sort.Strings(quiet)
+		sort.Strings(awake)
+
+		// users of unknown countries live in the default timezone
+		if policy.IsQuietHour(types.LocalHour(now, policy.DefaultTimezone)) {
+			res.AllowedCountryCodes = awake
+		} else if len(quiet) > 0 {
+			res.ExcludedCountryCodes = quiet
+		}
+	}
+
+	return res, policy.RateWindows(), nil
+}
+
+// previewMailingPolicy caps the preview batch size by the room currently left in the rate windows,
+// blocked reports that sending would be rejected right now.
+func (s *Server) previewMailingPolicy(botID, limit int, filter *types.MailingSegmentFilter, windows []types.MailingRateWindow) (int, *mailingPolicyPreview, error) {
+	preview := &mailingPolicyPreview{}
+
+	// quiet hours of the default timezone with no awake countries leave nobody to mail
+	if filter != nil && filter.AllowedCountryCodes != nil && len(filter.AllowedCountryCodes) == 0 {
+		preview.Blocked = true
+	}
+
+	limit, err := types.CapMailingLimit(limit, windows, func(seconds int) (int, error) {
+		return s.deps.PG.CountBotLeasedUsersSince(botID, seconds)
+	})
+
+	var rateErr *types.MailingRateLimitError
+	if errors.As(err, &rateErr) {
+		preview.Blocked = true
+		preview.RetryAfter = rateErr.RetryAfter
+		return 0, preview, nil
+	}
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return limit, preview, nil
+}
+
+// mailingPolicyError responds with 429 and Retry-After when the rate limit is exceeded.
+func (s *Server) mailingPolicyError(c *fiber.Ctx, err error) error {
+	var rateErr *types.MailingRateLimitError
+	if errors.As(err, &rateErr) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(rateErr.RetryAfter))
+		return s.TooManyRequests(c, err)
+	}
+
+	return s.InternalServerError(c, err)
+}
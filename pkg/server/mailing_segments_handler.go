@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/prosperofair/stata/pkg/pgsql"
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+var errMailingSegmentNotFound = errors.New("mailing segment not found")
+
+type mailingSegmentsSaveRequest struct {
+	BotToken string                     `json:"bot_token"`
+	Name     string                     `json:"name"`
+	Filter   types.MailingSegmentFilter `json:"filter"`
+}
+
+type mailingSegmentsSaveResponse struct {
+	Segment *types.MailingSegment `json:"segment"`
+}
+
+func (req *mailingSegmentsSaveRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingSegmentsSaveHandler(c *fiber.Ctx) error {
+	req := &mailingSegmentsSaveRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	segment := &types.MailingSegment{
+		BotID:  bot.ID,
+		Name:   req.Name,
+		Filter: req.Filter,
+	}
+
+	if err := s.deps.PG.UpsertMailingSegment(segment); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&mailingSegmentsSaveResponse{
+		Segment: segment,
+	})
+}
+
+type mailingSegmentsListRequest struct {
+	BotToken string `json:"bot_token"`
+}
+
+type mailingSegmentsListResponse struct {
+	Segments []*types.MailingSegment `json:"segments"`
+}
+
+func (req *mailingSegmentsListRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingSegmentsListHandler(c *fiber.Ctx) error {
+	req := &mailingSegmentsListRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	segments, err := s.deps.PG.SelectBotMailingSegments(bot.ID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&mailingSegmentsListResponse{
+		Segments: segments,
+	})
+}
+
+type mailingSegmentsDeleteRequest struct {
+	BotToken  string `json:"bot_token"`
+	SegmentID int    `json:"segment_id"`
+}
+
+func (req *mailingSegmentsDeleteRequest) validate() error {
+	if req.BotToken == "" {
+		return errors.New("bot_token is empty")
+	}
+
+	if req.SegmentID == 0 {
+		return errors.New("segment_id is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) mailingSegmentsDeleteHandler(c *fiber.Ctx) error {
+	req := &mailingSegmentsDeleteRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if err := s.deps.PG.DeleteMailingSegment(bot.ID, req.SegmentID); err != nil {
+		if errors.Is(err, pgsql.ErrMailingSegmentInUse) {
+			return s.BadRequest(c, err)
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	return s.ResponseOK(c)
+}
+
+// resolveMailingSegment returns the saved segment filter when id is set, otherwise the inline filter.
+func (s *Server) resolveMailingSegment(botID, id int, inline *types.MailingSegmentFilter) (*types.MailingSegmentFilter, error) {
+	if id == 0 {
+		return inline, nil
+	}
+
+	segment, err := s.deps.PG.SelectMailingSegment(id)
+	if err != nil || segment.BotID != botID {
+		return nil, errMailingSegmentNotFound
+	}
+
+	return &segment.Filter, nil
+}
@@ -33,6 +33,65 @@ var (
 		},
 		[]string{"path"},
 	)
+
+	metricDepotLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "depot_request_duration_seconds",
+			Help:      "Duration of depot channel lookups.",
+			Buckets:   prometheus.DefBuckets,
+		},
+	)
+
+	metricDepotErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "depot_errors_count",
+			Help:      "Number of failed depot channel lookups.",
+		},
+	)
+
+	metricDepotCache = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "depot_cache_count",
+			Help:      "Number of depot channel cache lookups by result.",
+		},
+		[]string{"result"},
+	)
+
+	metricDepotCircuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "depot_circuit_state",
+			Help:      "Depot circuit breaker state, 0 closed, 1 open, 2 half-open.",
+		},
+	)
+
+	metricDepotRefilledUsers = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "depot_refilled_users_count",
+			Help:      "Number of users assigned a channel after depot recovered.",
+		},
+	)
+
+	metricBotRegistryLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bot_registry_lookups_count",
+			Help:      "Number of bot registry lookups by result.",
+		},
+		[]string{"result"},
+	)
+
+	metricBotRegistrySize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "bot_registry_size",
+			Help:      "Number of bots held by the bot registry.",
+		},
+	)
 )
 
 func init() {
@@ -40,5 +99,12 @@ func init() {
 		metricStatusCodes,
 		metricsEvents,
 		metricPathRequests,
+		metricDepotLatency,
+		metricDepotErrors,
+		metricDepotCache,
+		metricDepotCircuitState,
+		metricDepotRefilledUsers,
+		metricBotRegistryLookups,
+		metricBotRegistrySize,
 	)
 }
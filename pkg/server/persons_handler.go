@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+const (
+	personsTimelineDefaultLimit = 200
+	personsTimelineMaxLimit     = 1000
+)
+
+type personsGetRequest struct {
+	TelegramID int64 `json:"telegram_id"`
+	Limit      int   `json:"limit"`
+}
+
+type personsGetResponse struct {
+	Person   *types.Person                `json:"person"`
+	Users    []*types.User                `json:"users"`
+	Bots     map[int]*types.Bot           `json:"bots"`
+	Timeline []*types.PersonTimelineEntry `json:"timeline"`
+
+	// TraceGroups lists the bots of the person by trace group
+	TraceGroups map[uuid.UUID][]int `json:"trace_groups"`
+}
+
+func (req *personsGetRequest) validate() error {
+	if req.TelegramID == 0 {
+		return errors.New("invalid telegram_id")
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = personsTimelineDefaultLimit
+	}
+
+	if req.Limit > personsTimelineMaxLimit {
+		req.Limit = personsTimelineMaxLimit
+	}
+
+	return nil
+}
+
+func (s *Server) personsGetHandler(c *fiber.Ctx) error {
+	req := &personsGetRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	person, err := s.deps.PG.SelectPersonByTelegramID(req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if person == nil {
+		return s.BadRequest(c, errors.New("person not found"))
+	}
+
+	users, err := s.deps.PG.SelectUsersByTelegramID(req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	timeline, err := s.deps.PG.SelectPersonTimeline(req.TelegramID, req.Limit)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	res := &personsGetResponse{
+		Person:      person,
+		Users:       users,
+		Bots:        make(map[int]*types.Bot),
+		Timeline:    timeline,
+		TraceGroups: make(map[uuid.UUID][]int),
+	}
+
+	for _, user := range users {
+		if _, ok := res.Bots[user.BotID]; ok {
+			continue
+		}
+
+		bot, err := s.deps.PG.SelectBotByID(user.BotID)
+		if err != nil {
+			continue
+		}
+
+		res.Bots[user.BotID] = bot
+		res.TraceGroups[bot.TraceUUID] = append(res.TraceGroups[bot.TraceUUID], bot.ID)
+	}
+
+	return c.JSON(res)
+}
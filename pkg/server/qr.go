@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	qrFormatPNG = "png"
+	qrFormatSVG = "svg"
+
+	qrDefaultSize = 256
+	qrMaxSize     = 2048
+)
+
+// renderQR encodes the content as a QR code, png images are returned base64 encoded.
+func renderQR(content, format string, size int) (string, error) {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode qr: %w", err)
+	}
+
+	switch format {
+	case qrFormatPNG:
+		png, err := qr.PNG(size)
+		if err != nil {
+			return "", fmt.Errorf("failed to render qr png: %w", err)
+		}
+
+		return base64.StdEncoding.EncodeToString(png), nil
+	case qrFormatSVG:
+		return qrSVG(qr.Bitmap(), size), nil
+	default:
+		return "", fmt.Errorf("unsupported qr format: %s", format)
+	}
+}
+
+func qrSVG(bitmap [][]bool, size int) string {
+	sb := strings.Builder{}
+
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, len(bitmap), len(bitmap))
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, len(bitmap), len(bitmap))
+
+	for y, row := range bitmap {
+		for x, black := range row {
+			if black {
+				fmt.Fprintf(&sb, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	sb.WriteString(`"/></svg>`)
+
+	return sb.String()
+}
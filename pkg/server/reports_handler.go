@@ -9,9 +9,11 @@ import (
 )
 
 type reportsFilterRequest struct {
-	BotToken string    `json:"bot_token"`
-	StartAt  time.Time `json:"start_at"`
-	EndAt    time.Time `json:"end_at"`
+	BotToken    string    `json:"bot_token"`
+	StartAt     time.Time `json:"start_at"`
+	EndAt       time.Time `json:"end_at"`
+	GroupBy     string    `json:"group_by"`
+	Attribution string    `json:"attribution"`
 }
 
 func (req *reportsFilterRequest) validate() error {
@@ -19,6 +21,22 @@ func (req *reportsFilterRequest) validate() error {
 		return errors.New("bot_token is empty")
 	}
 
+	if req.GroupBy == "" {
+		req.GroupBy = types.DeeplinkGroupByLabel
+	}
+
+	if _, ok := types.DeeplinkGroupByWhitelist[req.GroupBy]; !ok {
+		return errors.New("invalid group_by")
+	}
+
+	if req.Attribution == "" {
+		req.Attribution = types.AttributionModelFirstTouch
+	}
+
+	if _, ok := types.AttributionModelWhitelist[req.Attribution]; !ok {
+		return errors.New("invalid attribution")
+	}
+
 	return nil
 }
 
@@ -36,7 +54,12 @@ func (s *Server) reportsLeadsByCampaign(c *fiber.Ctx) error {
 		return s.BadRequest(c, err)
 	}
 
-	data, err := s.deps.PG.SelectLeadsByCampaign(req.BotToken, req.StartAt, req.EndAt)
+	bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	data, err := s.deps.PG.SelectLeadsByCampaign(bot.ID, req.GroupBy, req.Attribution, req.StartAt, req.EndAt)
 	if err != nil {
 		return s.InternalServerError(c, err)
 	}
@@ -24,6 +24,9 @@ type Server struct {
 
 	cfg  *Config
 	deps *Deps
+
+	depot *depotChannels
+	bots  *botRegistry
 }
 
 type Config struct {
@@ -31,6 +34,13 @@ type Config struct {
 
 	BackendTokens  map[string]struct{}
 	FrontendTokens map[string]struct{}
+
+	DepotCacheTTL         time.Duration
+	DepotBreakerThreshold int
+	DepotBreakerCooldown  time.Duration
+	DepotRefillInterval   time.Duration
+
+	BotRegistryRefreshInterval time.Duration
 }
 
 type Deps struct {
@@ -48,6 +58,9 @@ func New(cfg *Config, deps *Deps) *Server {
 
 		cfg:  cfg,
 		deps: deps,
+
+		depot: newDepotChannels(deps.Depot, cfg.DepotCacheTTL, cfg.DepotBreakerThreshold, cfg.DepotBreakerCooldown),
+		bots:  newBotRegistry(deps.PG, cfg.BotRegistryRefreshInterval > 0),
 	}
 
 	s.App.Use(cors.New())
@@ -66,6 +79,16 @@ func New(cfg *Config, deps *Deps) *Server {
 		go runMetricsExposer()
 	}
 
+	if cfg.DepotRefillInterval > 0 {
+		log.Info("run depot channels refill...")
+		go s.runDepotRefill(cfg.DepotRefillInterval)
+	}
+
+	if cfg.BotRegistryRefreshInterval > 0 {
+		log.Info("run bot registry refresh...")
+		go s.bots.Run(cfg.BotRegistryRefreshInterval)
+	}
+
 	// status checks
 	s.App.Get("/healthz", s.healthzHandler)
 
@@ -74,18 +97,57 @@ func New(cfg *Config, deps *Deps) *Server {
 	bot := api.Group("/bots")
 	bot.Post("/register", s.BotsRegisterHandler)
 	bot.Post("/import", s.BotsImportHandler)
+	bot.Post("/import/csv", s.botsImportCSVHandler)
 	bot.Post("/update/binding", s.BotsUpdateBindingHandler)
+	bot.Post("/update/buyer", s.botsUpdateBuyerHandler)
+	bot.Post("/rotate-token", s.botsRotateTokenHandler)
+	bot.Post("/list", s.botsListHandler)
+	bot.Post("/get", s.botsGetHandler)
+	bot.Post("/deactivate", s.botsDeactivateHandler)
+	bot.Post("/activate", s.botsActivateHandler)
+	bot.Post("/delete", s.botsDeleteHandler)
+
+	traceGroup := api.Group("/trace-groups")
+	traceGroup.Post("/create", s.traceGroupsCreateHandler)
+	traceGroup.Post("/update", s.traceGroupsUpdateHandler)
+	traceGroup.Post("/list", s.traceGroupsListHandler)
+	traceGroup.Post("/get", s.traceGroupsGetHandler)
+	traceGroup.Post("/delete", s.traceGroupsDeleteHandler)
+	traceGroup.Post("/members/add", s.traceGroupsMembersAddHandler)
+	traceGroup.Post("/members/remove", s.traceGroupsMembersRemoveHandler)
+	traceGroup.Post("/stats", s.traceGroupsStatsHandler)
 
 	user := api.Group("/users")
 	user.Post("/search", s.UsersSearchHandler)
 	user.Post("/get", s.UsersGetHandler)
+	user.Post("/profile", s.usersProfileHandler)
+	user.Post("/export", s.usersExportHandler)
+	user.Post("/erase", s.usersEraseHandler)
 	user.Post("/set/default-telegram-channel", s.UsersSetDefaultChannelHandler)
 	user.Post("/update/telegram-channel", s.UsersUpdateTelegramChannelHandler)
 
+	channel := api.Group("/channels")
+	channel.Post("/migrate", s.channelsMigrateHandler)
+	channel.Post("/migrations/list", s.channelsMigrationsListHandler)
+	channel.Post("/migrations/report", s.channelsMigrationsReportHandler)
+
+	person := api.Group("/persons")
+	person.Post("/get", s.personsGetHandler)
+
 	deeplink := api.Group("/deeplinks")
 	deeplink.Post("/create", s.DeeplinksCreateHandler)
+	deeplink.Post("/create/bulk", s.deeplinksCreateBulkHandler)
 	deeplink.Post("/list", s.DeeplinksListHandler)
 	deeplink.Post("/update", s.DeeplinksUpdateHandler)
+	deeplink.Post("/deactivate", s.deeplinksDeactivateHandler)
+	deeplink.Post("/reactivate", s.deeplinksReactivateHandler)
+	deeplink.Post("/delete", s.deeplinksDeleteHandler)
+	deeplink.Post("/merge", s.deeplinksMergeHandler)
+	deeplink.Post("/set/inactive-policy", s.deeplinksSetInactivePolicyHandler)
+	deeplink.Post("/update/metadata", s.deeplinksUpdateMetadataHandler)
+	deeplink.Post("/fbtool-links/link", s.deeplinksFBToolLinkHandler)
+	deeplink.Post("/fbtool-links/list", s.deeplinksFBToolLinksListHandler)
+	deeplink.Post("/fbtool-links/delete", s.deeplinksFBToolLinksDeleteHandler)
 
 	event := api.Group("/events")
 	event.Post("/submit/user-register", s.EventsSubmitUserRegisterHandler)
@@ -98,15 +160,42 @@ func New(cfg *Config, deps *Deps) *Server {
 	mailing.Post("/finish/users-list", s.MailingFinishUsersListHandler)
 	mailing.Post("/update/user-state", s.MailingUpdateUserStateHandler)
 
+	campaigns := mailing.Group("/campaigns")
+	campaigns.Post("/create", s.mailingCampaignsCreateHandler)
+	campaigns.Post("/lease", s.mailingCampaignsLeaseHandler)
+	campaigns.Post("/update/user-state", s.mailingCampaignsUpdateUserStateHandler)
+	campaigns.Post("/finish", s.mailingCampaignsFinishHandler)
+	campaigns.Post("/report", s.mailingCampaignsReportHandler)
+	campaigns.Post("/report/variants", s.mailingCampaignsVariantsReportHandler)
+
+	segments := mailing.Group("/segments")
+	segments.Post("/save", s.mailingSegmentsSaveHandler)
+	segments.Post("/list", s.mailingSegmentsListHandler)
+	segments.Post("/delete", s.mailingSegmentsDeleteHandler)
+
+	policies := mailing.Group("/policies")
+	policies.Post("/set", s.mailingPoliciesSetHandler)
+	policies.Post("/get", s.mailingPoliciesGetHandler)
+
+	deliveries := mailing.Group("/deliveries")
+	deliveries.Post("/list", s.mailingDeliveriesListHandler)
+
 	addresses := api.Group("/addresses")
 	addresses.Post("/create", s.addressesCreateHandler)
 	addresses.Post("/check", s.addressesCheckHandler)
 
+	expenses := api.Group("/expenses")
+	expenses.Post("/create", s.expensesCreateHandler)
+	expenses.Post("/import", s.expensesImportHandler)
+	expenses.Post("/list", s.expensesListHandler)
+	expenses.Post("/delete", s.expensesDeleteHandler)
+
 	transactions := api.Group("/transactions")
 	transactions.Post("/create", s.TransactionsCreateHandler)
 
 	stats := api.Group("/stats")
 	stats.Post("/mailing-state", s.StatsMailingStateHandler)
+	stats.Post("/mailing-blocks", s.statsMailingBlocksHandler)
 	stats.Post("/users-count", s.StatsUsersCountHandler) // used by depot to get bots stats
 
 	analytics := api.Group("/analytics")
@@ -182,6 +271,16 @@ func (s *Server) BadRequest(c *fiber.Ctx, err error) error {
 		JSON(response{err.Error()})
 }
 
+func (s *Server) Forbidden(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusForbidden).
+		JSON(response{err.Error()})
+}
+
+func (s *Server) TooManyRequests(c *fiber.Ctx, err error) error {
+	return c.Status(fiber.StatusTooManyRequests).
+		JSON(response{err.Error()})
+}
+
 func (s *Server) Unauthorized(c *fiber.Ctx) error {
 	return c.Status(fiber.StatusUnauthorized).
 		JSON(response{fiber.ErrUnauthorized.Message})
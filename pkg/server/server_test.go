@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// postJSON sends the body to the handler and returns the response status. Handlers of a server
+// without deps are used, so only requests rejected before touching the database can be tested.
+func postJSON(t *testing.T, handler fiber.Handler, body string) int {
+	t.Helper()
+
+	app := fiber.New()
+	app.Post("/", handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode
+}
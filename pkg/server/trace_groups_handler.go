@@ -0,0 +1,397 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/prosperofair/stata/pkg/pgsql"
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+type traceGroupsSaveRequest struct {
+	TraceUUID uuid.UUID `json:"trace_uuid"`
+	Name      string    `json:"name"`
+
+	DepotChannelHash   string `json:"depot_channel_hash"`
+	TelegramChannelID  int64  `json:"telegram_channel_id"`
+	TelegramChannelURL string `json:"telegram_channel_url"`
+
+	BindingPolicy string `json:"binding_policy"`
+}
+
+type traceGroupsSaveResponse struct {
+	Group *types.TraceGroup `json:"group"`
+}
+
+func (req *traceGroupsSaveRequest) validate() error {
+	if req.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	if req.BindingPolicy == "" {
+		req.BindingPolicy = types.TraceGroupBindingPolicyOldestUser
+	}
+
+	if _, ok := types.TraceGroupBindingPolicies[req.BindingPolicy]; !ok {
+		return errors.New("invalid binding_policy")
+	}
+
+	if req.BindingPolicy == types.TraceGroupBindingPolicyDefaultChannel && req.TelegramChannelID == 0 {
+		return errors.New("telegram_channel_id is required by default_channel policy")
+	}
+
+	return nil
+}
+
+func (req *traceGroupsSaveRequest) group() *types.TraceGroup {
+	return &types.TraceGroup{
+		TraceUUID:          req.TraceUUID,
+		Name:               req.Name,
+		DepotChannelHash:   req.DepotChannelHash,
+		TelegramChannelID:  req.TelegramChannelID,
+		TelegramChannelURL: req.TelegramChannelURL,
+		BindingPolicy:      req.BindingPolicy,
+	}
+}
+
+func (s *Server) traceGroupsCreateHandler(c *fiber.Ctx) error {
+	req := &traceGroupsSaveRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if req.TraceUUID == uuid.Nil {
+		req.TraceUUID = uuid.New()
+	}
+
+	group := req.group()
+	if err := s.deps.PG.CreateTraceGroup(group); err != nil {
+		if errors.Is(err, pgsql.ErrAlreadyExists) {
+			return s.BadRequest(c, errors.New("trace group already exists"))
+		}
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&traceGroupsSaveResponse{
+		Group: group,
+	})
+}
+
+func (s *Server) traceGroupsUpdateHandler(c *fiber.Ctx) error {
+	req := &traceGroupsSaveRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if req.TraceUUID == uuid.Nil {
+		return s.BadRequest(c, errors.New("trace_uuid is empty"))
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	group, err := s.deps.PG.SelectTraceGroup(req.TraceUUID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if group == nil {
+		return s.BadRequest(c, pgsql.ErrTraceGroupNotFound)
+	}
+
+	if err := s.deps.PG.UpdateTraceGroup(req.group()); err != nil {
+		return s.traceGroupError(c, err)
+	}
+
+	group, err = s.deps.PG.SelectTraceGroup(req.TraceUUID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&traceGroupsSaveResponse{
+		Group: group,
+	})
+}
+
+type traceGroupsListResponse struct {
+	Groups []*types.TraceGroup `json:"groups"`
+}
+
+func (s *Server) traceGroupsListHandler(c *fiber.Ctx) error {
+	groups, err := s.deps.PG.SelectTraceGroups()
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&traceGroupsListResponse{
+		Groups: groups,
+	})
+}
+
+type traceGroupsRequest struct {
+	TraceUUID uuid.UUID `json:"trace_uuid"`
+}
+
+func (req *traceGroupsRequest) validate() error {
+	if req.TraceUUID == uuid.Nil {
+		return errors.New("trace_uuid is empty")
+	}
+
+	return nil
+}
+
+type traceGroupsGetResponse struct {
+	Group *types.TraceGroup `json:"group"`
+	Bots  []*types.Bot      `json:"bots"`
+}
+
+func (s *Server) traceGroupsGetHandler(c *fiber.Ctx) error {
+	req := &traceGroupsRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	group, err := s.deps.PG.SelectTraceGroup(req.TraceUUID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if group == nil {
+		return s.BadRequest(c, pgsql.ErrTraceGroupNotFound)
+	}
+
+	bots, err := s.deps.PG.SelectTraceGroupBots(req.TraceUUID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(&traceGroupsGetResponse{
+		Group: group,
+		Bots:  bots,
+	})
+}
+
+func (s *Server) traceGroupsDeleteHandler(c *fiber.Ctx) error {
+	req := &traceGroupsRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	group, err := s.deps.PG.SelectTraceGroup(req.TraceUUID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if group == nil {
+		return s.BadRequest(c, pgsql.ErrTraceGroupNotFound)
+	}
+
+	if err := s.deps.PG.DeleteTraceGroup(req.TraceUUID); err != nil {
+		return s.traceGroupError(c, err)
+	}
+
+	// the group bots are detached, their tokens aren't known here
+	if err := s.bots.Reload(); err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return s.ResponseOK(c)
+}
+
+type traceGroupsMembersRequest struct {
+	TraceUUID uuid.UUID `json:"trace_uuid"`
+	BotTokens []string  `json:"bot_tokens"`
+
+	// Binding enables the group binding policy for the added bots
+	Binding bool `json:"binding"`
+}
+
+func (req *traceGroupsMembersRequest) validate() error {
+	if req.TraceUUID == uuid.Nil {
+		return errors.New("trace_uuid is empty")
+	}
+
+	if len(req.BotTokens) == 0 {
+		return errors.New("bot_tokens is empty")
+	}
+
+	return nil
+}
+
+func (s *Server) traceGroupsMembersAddHandler(c *fiber.Ctx) error {
+	req := &traceGroupsMembersRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	group, err := s.deps.PG.SelectTraceGroup(req.TraceUUID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if group == nil {
+		return s.BadRequest(c, pgsql.ErrTraceGroupNotFound)
+	}
+
+	bots, err := s.traceGroupMembers(req.BotTokens)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateBotsTraceGroup(botIDs(bots), req.TraceUUID, req.Binding); err != nil {
+		return s.botError(c, err)
+	}
+
+	s.bots.Invalidate(botTokens(bots)...)
+
+	return s.ResponseOK(c)
+}
+
+func (s *Server) traceGroupsMembersRemoveHandler(c *fiber.Ctx) error {
+	req := &traceGroupsMembersRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	bots, err := s.traceGroupMembers(req.BotTokens)
+	if err != nil {
+		return s.botError(c, err)
+	}
+
+	if err := s.deps.PG.UpdateBotsTraceGroup(botIDs(bots), uuid.Nil, false); err != nil {
+		return s.botError(c, err)
+	}
+
+	s.bots.Invalidate(botTokens(bots)...)
+
+	return s.ResponseOK(c)
+}
+
+// traceGroupMembers resolves the tokens to bots, a bot given by both its token and alias is returned once.
+func (s *Server) traceGroupMembers(tokens []string) ([]*types.Bot, error) {
+	res := make([]*types.Bot, 0, len(tokens))
+	seen := make(map[int]struct{}, len(tokens))
+
+	for _, token := range tokens {
+		bot, err := s.deps.PG.SelectBotByToken(token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, token)
+		}
+
+		if _, ok := seen[bot.ID]; ok {
+			continue
+		}
+
+		seen[bot.ID] = struct{}{}
+		res = append(res, bot)
+	}
+
+	return res, nil
+}
+
+func botIDs(bots []*types.Bot) []int {
+	res := make([]int, 0, len(bots))
+	for _, bot := range bots {
+		res = append(res, bot.ID)
+	}
+
+	return res
+}
+
+func botTokens(bots []*types.Bot) []string {
+	res := make([]string, 0, len(bots))
+	for _, bot := range bots {
+		res = append(res, bot.BotToken)
+	}
+
+	return res
+}
+
+type traceGroupsStatsRequest struct {
+	TraceUUID uuid.UUID `json:"trace_uuid"`
+
+	StartAt string    `json:"start_at"`
+	Start   time.Time `json:"-"`
+
+	EndAt string    `json:"end_at"`
+	End   time.Time `json:"-"`
+}
+
+func (req *traceGroupsStatsRequest) validate() error {
+	if req.TraceUUID == uuid.Nil {
+		return errors.New("trace_uuid is empty")
+	}
+
+	sat, err := time.Parse(time.DateOnly, req.StartAt)
+	if err != nil {
+		sat = time.Now().AddDate(0, -1, 0)
+	}
+	req.Start = sat
+
+	eat, err := time.Parse(time.DateOnly, req.EndAt)
+	if err != nil {
+		eat = time.Now()
+	}
+	req.End = eat
+
+	if !req.End.After(req.Start) {
+		req.End = req.Start.Add(24 * time.Hour)
+	}
+
+	// -1 day to account for the specified date
+	req.Start = req.Start.AddDate(0, 0, -1)
+
+	return nil
+}
+
+func (s *Server) traceGroupsStatsHandler(c *fiber.Ctx) error {
+	req := &traceGroupsStatsRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	stats, err := s.deps.PG.SelectTraceGroupStats(req.TraceUUID, req.Start, req.End)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	return c.JSON(stats)
+}
+
+// traceGroupError responds with 400 to groups removed meanwhile.
+func (s *Server) traceGroupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, pgsql.ErrTraceGroupNotFound) {
+		return s.BadRequest(c, err)
+	}
+
+	return s.InternalServerError(c, err)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTraceGroupsStatsRequestValidateRange(t *testing.T) {
+	req := &traceGroupsStatsRequest{
+		TraceUUID: uuid.New(),
+		StartAt:   "2024-01-10",
+		EndAt:     "2024-01-10",
+	}
+
+	if err := req.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	// stats are filtered by date(x) > start and date(x) <= end, so start is moved a day back
+	if want := time.Date(2024, 1, 9, 0, 0, 0, 0, time.UTC); !req.Start.Equal(want) {
+		t.Errorf("start = %v, want %v", req.Start, want)
+	}
+
+	if want := time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC); !req.End.Equal(want) {
+		t.Errorf("end = %v, want %v", req.End, want)
+	}
+}
@@ -1,26 +1,69 @@
 package server
 
 import (
+	"encoding/base64"
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/prosperofair/stata/pkg/types"
 )
 
+const (
+	usersSearchDefaultLimit = 20
+	usersSearchMaxLimit     = 100
+)
+
 type UsersSearchRequest struct {
-	TelegramID int64  `json:"telegram_id"`
-	Username   string `json:"username"`
+	TelegramID int64 `json:"telegram_id"`
 
+	// Query is matched by prefix and similarity against name, username and forward sender name,
+	// Username and ForwardSenderName are kept as aliases of Query
+	Query             string `json:"query"`
+	Username          string `json:"username"`
 	ForwardSenderName string `json:"forward_sender_name"`
+
+	BotToken    string     `json:"bot_token"`
+	Deposited   *bool      `json:"deposited"`
+	CreatedFrom *time.Time `json:"created_from"`
+	CreatedTo   *time.Time `json:"created_to"`
+
+	Limit  int    `json:"limit"`
+	Cursor string `json:"cursor"`
 }
 
 type UsersSearchResponse struct {
-	Users []*types.User      `json:"users"`
-	Bots  map[int]*types.Bot `json:"bots"`
+	Users      []*types.User      `json:"users"`
+	Bots       map[int]*types.Bot `json:"bots"`
+	NextCursor string             `json:"next_cursor,omitempty"`
 }
 
 func (req *UsersSearchRequest) validate() error {
+	if req.Query == "" {
+		req.Query = req.Username
+	}
+
+	if req.Query == "" {
+		req.Query = req.ForwardSenderName
+	}
+
+	req.Query = strings.TrimPrefix(strings.TrimSpace(req.Query), "@")
+
+	if req.TelegramID == 0 && req.Query == "" {
+		return errors.New("query is empty")
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = usersSearchDefaultLimit
+	}
+
+	if req.Limit > usersSearchMaxLimit {
+		req.Limit = usersSearchMaxLimit
+	}
+
 	return nil
 }
 
@@ -47,20 +90,43 @@ func (s *Server) UsersSearchHandler(c *fiber.Ctx) error {
 		}
 
 		res.Users = users
-	} else if req.Username != "" {
-		users, err := s.deps.PG.SelectUsersByUsername(req.Username)
-		if err != nil {
-			return s.InternalServerError(c, err)
+	} else {
+		filter := &types.UsersSearchFilter{
+			Query:       req.Query,
+			Deposited:   req.Deposited,
+			CreatedFrom: req.CreatedFrom,
+			CreatedTo:   req.CreatedTo,
+			Limit:       req.Limit,
 		}
 
-		res.Users = users
-	} else {
-		users, err := s.deps.PG.SelectUsersByForwardSenderName(req.ForwardSenderName)
+		if req.BotToken != "" {
+			bot, err := s.deps.PG.SelectBotByToken(req.BotToken)
+			if err != nil {
+				return s.InternalServerError(c, err)
+			}
+
+			filter.BotID = bot.ID
+		}
+
+		if req.Cursor != "" {
+			cursor, err := decodeUsersSearchCursor(req.Cursor)
+			if err != nil {
+				return s.BadRequest(c, err)
+			}
+
+			filter.Cursor = cursor
+		}
+
+		users, next, err := s.deps.PG.SearchUsers(filter)
 		if err != nil {
 			return s.InternalServerError(c, err)
 		}
 
 		res.Users = users
+
+		if next != nil {
+			res.NextCursor = encodeUsersSearchCursor(next)
+		}
 	}
 
 	for _, user := range res.Users {
@@ -74,11 +140,38 @@ func (s *Server) UsersSearchHandler(c *fiber.Ctx) error {
 		}
 	}
 
-	if len(res.Users) > 5 {
-		res.Users = res.Users[:5]
+	return c.JSON(res)
+}
+
+// encodeUsersSearchCursor packs the cursor into an opaque url safe string.
+func encodeUsersSearchCursor(cursor *types.UsersSearchCursor) string {
+	raw := strconv.FormatFloat(cursor.Score, 'g', -1, 64) + ":" + strconv.Itoa(cursor.ID)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeUsersSearchCursor(cursor string) (*types.UsersSearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	score, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.New("invalid cursor")
 	}
 
-	return c.JSON(res)
+	res := &types.UsersSearchCursor{}
+
+	if res.Score, err = strconv.ParseFloat(score, 64); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	if res.ID, err = strconv.Atoi(id); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return res, nil
 }
 
 type UsersGetRequest struct {
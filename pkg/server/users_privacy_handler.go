@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prosperofair/pkg/log"
+	"go.uber.org/zap"
+
+	"github.com/prosperofair/stata/pkg/pgsql"
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+type usersPrivacyRequest struct {
+	TelegramID int64 `json:"telegram_id"`
+}
+
+func (req *usersPrivacyRequest) validate() error {
+	if req.TelegramID <= 0 {
+		return errors.New("invalid telegram_id")
+	}
+
+	return nil
+}
+
+type usersExportBotUser struct {
+	*usersProfileBotUser
+
+	MailingCampaigns []*types.MailingCampaignUser `json:"mailing_campaigns"`
+}
+
+type usersExportResponse struct {
+	Person *types.Person         `json:"person"`
+	Bots   map[int]*types.Bot    `json:"bots"`
+	Users  []*usersExportBotUser `json:"users"`
+
+	// ReferralDeeplinks are the deeplinks inviting other users on behalf of the person
+	ReferralDeeplinks []*types.Deeplink `json:"referral_deeplinks"`
+}
+
+func (s *Server) usersExportHandler(c *fiber.Ctx) error {
+	req := &usersPrivacyRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	users, err := s.deps.PG.SelectUsersByTelegramID(req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if len(users) == 0 {
+		return s.BadRequest(c, errors.New("user not found"))
+	}
+
+	person, err := s.deps.PG.SelectPersonByTelegramID(req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	referrals, err := s.deps.PG.SelectDeeplinksByReferralTelegramID(req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	res := &usersExportResponse{
+		Person:            person,
+		Bots:              make(map[int]*types.Bot),
+		Users:             make([]*usersExportBotUser, 0, len(users)),
+		ReferralDeeplinks: referrals,
+	}
+
+	for _, user := range users {
+		if _, ok := res.Bots[user.BotID]; !ok {
+			bot, err := s.deps.PG.SelectBotByID(user.BotID)
+			if err == nil {
+				res.Bots[user.BotID] = bot
+			}
+		}
+
+		// the export is never truncated
+		profile, err := s.usersProfileBotUser(user, math.MaxInt32)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		campaigns, err := s.deps.PG.SelectUserMailingCampaignUsers(user.ID)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		res.Users = append(res.Users, &usersExportBotUser{
+			usersProfileBotUser: profile,
+			MailingCampaigns:    campaigns,
+		})
+	}
+
+	return c.JSON(res)
+}
+
+type usersEraseResponse struct {
+	Users int `json:"users"`
+}
+
+func (s *Server) usersEraseHandler(c *fiber.Ctx) error {
+	req := &usersPrivacyRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	pseudonym, erased, err := s.deps.PG.ErasePerson(req.TelegramID)
+	if err != nil {
+		if errors.Is(err, pgsql.ErrPersonNotFound) {
+			return s.BadRequest(c, err)
+		}
+
+		return s.InternalServerError(c, err)
+	}
+
+	log.Info("person erased", zap.Int64("pseudonym", pseudonym), zap.Int("users", erased))
+
+	return c.JSON(&usersEraseResponse{
+		Users: erased,
+	})
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/prosperofair/stata/pkg/types"
+)
+
+const (
+	usersProfileDefaultLimit = 50
+	usersProfileMaxLimit     = 500
+)
+
+type usersProfileRequest struct {
+	TelegramID int64 `json:"telegram_id"`
+
+	// Limit caps the recent events and mailing deliveries of every bot user
+	Limit int `json:"limit"`
+}
+
+// usersProfileBotUser is the activity of the person in a single bot.
+type usersProfileBotUser struct {
+	User *types.User `json:"user"`
+
+	Deeplink  *types.Deeplink        `json:"deeplink"`
+	Touches   []*types.DeeplinkTouch `json:"touches"`
+	PixelLink *types.PixelLink       `json:"pixel_link"`
+
+	ChannelAssignments []*types.UserChannelAssignment `json:"channel_assignments"`
+
+	MailingDeliveries []*types.MailingDelivery `json:"mailing_deliveries"`
+
+	Transactions []*types.Transaction `json:"transactions"`
+	DepositsUSD  float64              `json:"deposits_usd"`
+
+	Events []*types.EventsLog `json:"events"`
+}
+
+type usersProfileResponse struct {
+	Person *types.Person          `json:"person"`
+	Bots   map[int]*types.Bot     `json:"bots"`
+	Users  []*usersProfileBotUser `json:"users"`
+
+	DepositsUSD float64 `json:"deposits_usd"`
+}
+
+func (req *usersProfileRequest) validate() error {
+	if req.TelegramID == 0 {
+		return errors.New("invalid telegram_id")
+	}
+
+	if req.Limit <= 0 {
+		req.Limit = usersProfileDefaultLimit
+	}
+
+	if req.Limit > usersProfileMaxLimit {
+		req.Limit = usersProfileMaxLimit
+	}
+
+	return nil
+}
+
+func (s *Server) usersProfileHandler(c *fiber.Ctx) error {
+	req := &usersProfileRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	if err := req.validate(); err != nil {
+		return s.BadRequest(c, err)
+	}
+
+	users, err := s.deps.PG.SelectUsersByTelegramID(req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	if len(users) == 0 {
+		return s.BadRequest(c, errors.New("user not found"))
+	}
+
+	person, err := s.deps.PG.SelectPersonByTelegramID(req.TelegramID)
+	if err != nil {
+		return s.InternalServerError(c, err)
+	}
+
+	res := &usersProfileResponse{
+		Person: person,
+		Bots:   make(map[int]*types.Bot),
+		Users:  make([]*usersProfileBotUser, 0, len(users)),
+	}
+
+	for _, user := range users {
+		if _, ok := res.Bots[user.BotID]; !ok {
+			bot, err := s.deps.PG.SelectBotByID(user.BotID)
+			if err == nil {
+				res.Bots[user.BotID] = bot
+			}
+		}
+
+		profile, err := s.usersProfileBotUser(user, req.Limit)
+		if err != nil {
+			return s.InternalServerError(c, err)
+		}
+
+		res.DepositsUSD += profile.DepositsUSD
+		res.Users = append(res.Users, profile)
+	}
+
+	return c.JSON(res)
+}
+
+func (s *Server) usersProfileBotUser(user *types.User, limit int) (*usersProfileBotUser, error) {
+	var err error
+
+	res := &usersProfileBotUser{
+		User: user,
+	}
+
+	if user.DeeplinkID != 0 {
+		if res.Deeplink, err = s.deps.PG.SelectDeeplinkByID(user.DeeplinkID); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.Touches, err = s.deps.PG.SelectUserDeeplinkTouches(user.ID); err != nil {
+		return nil, err
+	}
+
+	if user.InviteUUID != uuid.Nil {
+		if res.PixelLink, err = s.deps.PG.SelectPixelLink(user.InviteUUID.String()); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.ChannelAssignments, err = s.deps.PG.SelectUserChannelAssignments(user.ID); err != nil {
+		return nil, err
+	}
+
+	if res.MailingDeliveries, err = s.deps.PG.SelectUserMailingDeliveries(user.ID, limit); err != nil {
+		return nil, err
+	}
+
+	if res.Transactions, err = s.deps.PG.SelectUserTransactions(user.ID); err != nil {
+		return nil, err
+	}
+
+	for _, tx := range res.Transactions {
+		res.DepositsUSD += tx.USD
+	}
+
+	if res.Events, err = s.deps.PG.SelectUserEventsLogs(user.ID, limit); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -33,6 +33,9 @@ type Transaction struct {
 	Amount float64 `db:"amount" json:"amount"`
 	Price  float64 `db:"price" json:"price"`
 
+	// USD is the amount multiplied by the price, it is only selected and never stored
+	USD float64 `db:"usd" json:"usd"`
+
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
@@ -1,6 +1,11 @@
 package types
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,7 +14,8 @@ import (
 type Bot struct {
 	ID int `db:"id" json:"id"`
 
-	APIKey      string    `db:"api_key" json:"api_key"`
+	// APIKey is the telegram bot secret, it is never returned by the api
+	APIKey      string    `db:"api_key" json:"-"`
 	BotToken    string    `db:"bot_token" json:"bot_token"`
 	BotUsername string    `db:"bot_username" json:"bot_username"`
 	BotType     string    `db:"bot_type" json:"bot_type"`
@@ -19,6 +25,112 @@ type Bot struct {
 
 	Active bool `db:"active" json:"active"`
 
+	// InactiveDeeplinkPolicy decides how users coming by inactive deeplinks are attributed
+	InactiveDeeplinkPolicy string `db:"inactive_deeplink_policy" json:"inactive_deeplink_policy"`
+	FallbackDeeplinkID     int    `db:"fallback_deeplink_id" json:"fallback_deeplink_id"`
+
+	// DeletedAt is set when the bot is deleted, deleted bots stay inactive and keep their history
+	DeletedAt time.Time `db:"deleted_at" json:"deleted_at"`
+
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
+
+const (
+	BotTokenDefaultGracePeriod = 24 * time.Hour
+	BotTokenMaxGracePeriod     = 30 * 24 * time.Hour
+)
+
+// BotTokenAlias is a previous token of the rotated bot, accepted until it expires.
+type BotTokenAlias struct {
+	ID       int    `db:"id" json:"id"`
+	BotID    int    `db:"bot_id" json:"bot_id"`
+	BotToken string `db:"bot_token" json:"bot_token"`
+
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// BotsFilter narrows the bots list, empty fields match every bot.
+type BotsFilter struct {
+	BID       string
+	BotType   string
+	Active    *bool
+	TraceUUID *uuid.UUID
+
+	IncludeDeleted bool
+}
+
+const (
+	BotImportStatusCreated = "created"
+	BotImportStatusUpdated = "updated"
+	BotImportStatusFailed  = "failed"
+)
+
+// BotImportResult is the outcome of a single imported bot, Index is its position in the import.
+type BotImportResult struct {
+	Index       int    `json:"index"`
+	BotUsername string `json:"bot_username"`
+	BotToken    string `json:"bot_token,omitempty"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// ParseBotsCSV reads bots from csv with a header row, api_key column is required,
+// bot_username, bot_type, bid and trace_uuid are optional.
+func ParseBotsCSV(r io.Reader) ([]*Bot, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["api_key"]; !ok {
+		return nil, errors.New("csv column api_key is missing")
+	}
+
+	value := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	res := make([]*Bot, 0)
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv line %d: %w", line, err)
+		}
+
+		bot := &Bot{
+			APIKey:      value(record, "api_key"),
+			BotUsername: value(record, "bot_username"),
+			BotType:     value(record, "bot_type"),
+			BID:         value(record, "bid"),
+		}
+
+		if v := value(record, "trace_uuid"); v != "" {
+			if bot.TraceUUID, err = uuid.Parse(v); err != nil {
+				return nil, fmt.Errorf("invalid trace_uuid on line %d: %w", line, err)
+			}
+		}
+
+		res = append(res, bot)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,82 @@
+package types
+
+import "time"
+
+const (
+	// reasons the user was assigned to a channel
+	ChannelAssignmentReasonAssigned  = "assigned"
+	ChannelAssignmentReasonDefault   = "default"
+	ChannelAssignmentReasonUpdate    = "update"
+	ChannelAssignmentReasonMigration = "migration"
+	ChannelAssignmentReasonSync      = "sync"
+
+	// channel migrations are started manually or by the depot sync of dead and changed channels
+	ChannelMigrationReasonManual = "manual"
+	ChannelMigrationReasonSync   = "sync"
+)
+
+// UserChannel is the depot channel the user is invited to.
+type UserChannel struct {
+	DepotChannelHash   string `json:"depot_channel_hash"`
+	TelegramChannelID  int64  `json:"telegram_channel_id"`
+	TelegramChannelURL string `json:"telegram_channel_url"`
+}
+
+// UserChannelAssignment is a period the user was assigned to a channel, open assignments
+// have a zero unix UnassignedAt.
+type UserChannelAssignment struct {
+	ID     int `db:"id" json:"id"`
+	UserID int `db:"user_id" json:"user_id"`
+	BotID  int `db:"bot_id" json:"bot_id"`
+
+	DepotChannelHash   string `db:"depot_channel_hash" json:"depot_channel_hash"`
+	TelegramChannelID  int64  `db:"telegram_channel_id" json:"telegram_channel_id"`
+	TelegramChannelURL string `db:"telegram_channel_url" json:"telegram_channel_url"`
+
+	Reason      string `db:"reason" json:"reason"`
+	MigrationID int    `db:"migration_id" json:"migration_id"`
+
+	// PreviousSubscribed is the subscription to the previous channel, WasSubscribed to this one when it ended
+	PreviousSubscribed bool `db:"previous_subscribed" json:"previous_subscribed"`
+	WasSubscribed      bool `db:"was_subscribed" json:"was_subscribed"`
+
+	AssignedAt   time.Time `db:"assigned_at" json:"assigned_at"`
+	UnassignedAt time.Time `db:"unassigned_at" json:"unassigned_at"`
+}
+
+type ChannelMigration struct {
+	ID    int `db:"id" json:"id"`
+	BotID int `db:"bot_id" json:"bot_id"`
+
+	FromDepotChannelHash string `db:"from_depot_channel_hash" json:"from_depot_channel_hash"`
+	ToDepotChannelHash   string `db:"to_depot_channel_hash" json:"to_depot_channel_hash"`
+	ToTelegramChannelID  int64  `db:"to_telegram_channel_id" json:"to_telegram_channel_id"`
+	ToTelegramChannelURL string `db:"to_telegram_channel_url" json:"to_telegram_channel_url"`
+
+	Percent float64              `db:"percent" json:"percent"`
+	Segment MailingSegmentFilter `db:"segment" json:"segment"`
+	Users   int                  `db:"users" json:"users"`
+	Reason  string               `db:"reason" json:"reason"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// UserChannelUsage is a channel the bot users are assigned to.
+type UserChannelUsage struct {
+	DepotChannelHash   string `db:"depot_channel_hash" json:"depot_channel_hash"`
+	TelegramChannelID  int64  `db:"telegram_channel_id" json:"telegram_channel_id"`
+	TelegramChannelURL string `db:"telegram_channel_url" json:"telegram_channel_url"`
+	Users              int    `db:"users" json:"users"`
+}
+
+// ChannelMigrationReport compares the subscriptions of the migrated users before and after the migration.
+type ChannelMigrationReport struct {
+	MigrationID int `db:"migration_id" json:"migration_id"`
+
+	Users            int `db:"users" json:"users"`
+	SubscribedBefore int `db:"subscribed_before" json:"subscribed_before"`
+	SubscribedAfter  int `db:"subscribed_after" json:"subscribed_after"`
+
+	SubscribedBeforeRate float64 `db:"-" json:"subscribed_before_rate"`
+	SubscribedAfterRate  float64 `db:"-" json:"subscribed_after_rate"`
+}
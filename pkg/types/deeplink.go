@@ -1,16 +1,56 @@
 package types
 
 import (
-	"math/rand"
+	"crypto/rand"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const (
 	DeeplinkLabelReferral = "referral"
+
+	// inactive deeplinks attribute nobody or the bot fallback deeplink
+	DeeplinkInactivePolicyNone     = "none"
+	DeeplinkInactivePolicyFallback = "fallback"
+
+	// fields by-campaign reports can be grouped by
+	DeeplinkGroupByLabel    = "label"
+	DeeplinkGroupBySource   = "source"
+	DeeplinkGroupByCampaign = "campaign"
+	DeeplinkGroupByAdSet    = "ad_set"
+	DeeplinkGroupByCreative = "creative"
+	DeeplinkGroupByBuyer    = "buyer"
+	DeeplinkGroupByTag      = "tag"
+)
+
+const (
+	// attribution models splitting a user between the deeplinks the user came through,
+	// they apply only to the by-campaign reports (conversions by campaign and leads by campaign),
+	// there is no LTV report yet and the rest of the reports aren't grouped by deeplinks
+	AttributionModelFirstTouch = "first_touch"
+	AttributionModelLastTouch  = "last_touch"
+	AttributionModelLinear     = "linear"
 )
 
+var AttributionModelWhitelist = map[string]struct{}{
+	AttributionModelFirstTouch: {},
+	AttributionModelLastTouch:  {},
+	AttributionModelLinear:     {},
+}
+
+var DeeplinkGroupByWhitelist = map[string]struct{}{
+	DeeplinkGroupByLabel:    {},
+	DeeplinkGroupBySource:   {},
+	DeeplinkGroupByCampaign: {},
+	DeeplinkGroupByAdSet:    {},
+	DeeplinkGroupByCreative: {},
+	DeeplinkGroupByBuyer:    {},
+	DeeplinkGroupByTag:      {},
+}
+
 type Deeplink struct {
 	ID    int `db:"id" json:"id"`
 	BotID int `db:"bot_id" json:"bot_id"`
@@ -19,27 +59,98 @@ type Deeplink struct {
 	Hash               string `db:"hash" json:"hash"`
 	Label              string `db:"label" json:"label"`
 
-	Active bool `db:"active" json:"active"`
+	Source   string         `db:"source" json:"source"`
+	Campaign string         `db:"campaign" json:"campaign"`
+	AdSet    string         `db:"ad_set" json:"ad_set"`
+	Creative string         `db:"creative" json:"creative"`
+	Buyer    string         `db:"buyer" json:"buyer"`
+	Tags     pq.StringArray `db:"tags" json:"tags"`
+
+	Active   bool `db:"active" json:"active"`
+	Archived bool `db:"archived" json:"archived"`
 
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
 }
 
+// DeeplinkTouch is a single entry of a user through a deeplink.
+type DeeplinkTouch struct {
+	ID         int `db:"id" json:"id"`
+	UserID     int `db:"user_id" json:"user_id"`
+	DeeplinkID int `db:"deeplink_id" json:"deeplink_id"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type DeeplinkLabelMerge struct {
+	ID        int    `db:"id" json:"id"`
+	BotID     int    `db:"bot_id" json:"bot_id"`
+	FromLabel string `db:"from_label" json:"from_label"`
+	ToLabel   string `db:"to_label" json:"to_label"`
+	Deeplinks int    `db:"deeplinks" json:"deeplinks"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
 const (
 	deeplinkHashLength  = 10
 	deeplinkHashSymbols = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789abcdefghijklmnopqrstuvwxyz"
 )
 
+// GenerateDeeplinkHash returns a crypto-random hash, bytes outside of the largest multiple
+// of the alphabet size are rejected so every symbol is equally likely.
 func GenerateDeeplinkHash() string {
-	var key string
+	const limit = 256 - 256%len(deeplinkHashSymbols)
+
+	key := make([]byte, 0, deeplinkHashLength)
+	buf := make([]byte, deeplinkHashLength*2)
 
-	rs := []rune(deeplinkHashSymbols)
-	lenOfArray := len(rs)
+	for len(key) < deeplinkHashLength {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("crypto/rand is unavailable: %v", err))
+		}
 
-	for i := 0; i < deeplinkHashLength; i++ {
-		key += string(rs[rand.Intn(lenOfArray)])
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+
+			key = append(key, deeplinkHashSymbols[int(b)%len(deeplinkHashSymbols)])
+			if len(key) == deeplinkHashLength {
+				break
+			}
+		}
 	}
-	return key
+
+	return string(key)
+}
+
+// DeeplinkURL returns the telegram url starting the bot with the deeplink hash.
+func DeeplinkURL(botUsername, hash string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", botUsername, hash)
+}
+
+type DeeplinkFBToolLink struct {
+	ID              int `db:"id" json:"id"`
+	DeeplinkID      int `db:"deeplink_id" json:"deeplink_id"`
+	FBToolAccountID int `db:"fbtool_account_id" json:"fbtool_account_id"`
+
+	// CampaignID narrows the link to a single fbtool campaign, empty means the whole account
+	CampaignID string `db:"campaign_id" json:"campaign_id"`
+
+	// Share is the percentage of the account or campaign spend attributed to the deeplink
+	Share float64 `db:"share" json:"share"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// DeeplinkFBToolLinkShareError is returned when the link share exceeds what is left of the account spend.
+type DeeplinkFBToolLinkShareError struct {
+	Remaining float64
+}
+
+func (e *DeeplinkFBToolLinkShareError) Error() string {
+	return fmt.Sprintf("share exceeds the remaining %.2f percent", e.Remaining)
 }
 
 type PixelLink struct {
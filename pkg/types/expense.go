@@ -0,0 +1,32 @@
+package types
+
+import (
+	"time"
+)
+
+const (
+	ExpenseSourceManual = "manual"
+	ExpenseSourceCSV    = "csv"
+
+	// sizes of the expenses columns
+	ExpenseLabelMaxLength  = 255
+	ExpenseSourceMaxLength = 64
+)
+
+type Expense struct {
+	ID     int    `db:"id" json:"id"`
+	BotID  int    `db:"bot_id" json:"bot_id"`
+	Label  string `db:"label" json:"label"`
+	Source string `db:"source" json:"source"`
+
+	Date        time.Time `db:"date" json:"date"`
+	Spend       float64   `db:"spend" json:"spend"`
+	Clicks      int       `db:"clicks" json:"clicks"`
+	Impressions int       `db:"impressions" json:"impressions"`
+
+	// BotToken is only used by imports which mix several bots
+	BotToken string `db:"-" json:"bot_token,omitempty"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,313 @@
+package types
+
+import (
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MailingCampaignStateActive   = "active"
+	MailingCampaignStateFinished = "finished"
+
+	MailingCampaignUserStateLeased  = "leased"
+	MailingCampaignUserStateSent    = "sent"
+	MailingCampaignUserStateBlocked = "blocked"
+	MailingCampaignUserStateFailed  = "failed"
+
+	MailingLeaseStateActive   = "active"
+	MailingLeaseStateReleased = "released"
+	MailingLeaseStateExpired  = "expired"
+
+	MailingLeaseDefaultTTL = 10 * time.Minute
+	MailingLeaseMaxTTL     = 24 * time.Hour
+
+	MailingAttributionDefaultWindow = 72 * time.Hour
+)
+
+type MailingCampaign struct {
+	ID    int `db:"id" json:"id"`
+	BotID int `db:"bot_id" json:"bot_id"`
+
+	DepotChannelHash string `db:"depot_channel_hash" json:"depot_channel_hash"`
+	Name             string `db:"name" json:"name"`
+	SegmentID        int    `db:"segment_id" json:"segment_id"`
+
+	State      string    `db:"state" json:"state"`
+	StartedAt  time.Time `db:"started_at" json:"started_at"`
+	FinishedAt time.Time `db:"finished_at" json:"finished_at"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// Duration returns how long the campaign has been running, or how long it ran if it is finished.
+func (mc *MailingCampaign) Duration() time.Duration {
+	if mc.State == MailingCampaignStateFinished {
+		return mc.FinishedAt.Sub(mc.StartedAt)
+	}
+
+	return time.Since(mc.StartedAt)
+}
+
+type MailingCampaignUser struct {
+	ID         int `db:"id" json:"id"`
+	CampaignID int `db:"campaign_id" json:"campaign_id"`
+	UserID     int `db:"user_id" json:"user_id"`
+	VariantID  int `db:"variant_id" json:"variant_id"`
+
+	State string `db:"state" json:"state"`
+	Error string `db:"error" json:"error"`
+
+	// SentAt is when the user was reported sent, the variant attribution window starts here
+	SentAt time.Time `db:"sent_at" json:"sent_at"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type MailingCampaignVariant struct {
+	ID         int `db:"id" json:"id"`
+	CampaignID int `db:"campaign_id" json:"campaign_id"`
+
+	Name    string `db:"name" json:"name"`
+	Weight  int    `db:"weight" json:"weight"`
+	Payload string `db:"payload" json:"payload"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// PickMailingCampaignVariant deterministically assigns the user to one of the variants
+// proportionally to their weights, the same user always gets the same variant of a campaign.
+func PickMailingCampaignVariant(variants []*MailingCampaignVariant, campaignID, userID int) *MailingCampaignVariant {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+
+	if total <= 0 {
+		return nil
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(strconv.Itoa(campaignID) + ":" + strconv.Itoa(userID)))
+
+	point := int(h.Sum32() % uint32(total))
+	for _, v := range variants {
+		if point < v.Weight {
+			return v
+		}
+
+		point -= v.Weight
+	}
+
+	return nil
+}
+
+type MailingCampaignVariantStats struct {
+	VariantID int `db:"variant_id" json:"variant_id"`
+
+	Total   int `db:"total" json:"total"`
+	Sent    int `db:"sent" json:"sent"`
+	Blocked int `db:"blocked" json:"blocked"`
+	Failed  int `db:"failed" json:"failed"`
+
+	Messaged  int     `db:"messaged" json:"messaged"`
+	Launched  int     `db:"launched" json:"launched"`
+	Deposited int     `db:"deposited" json:"deposited"`
+	Income    float64 `db:"income" json:"income"`
+
+	DeliveryRate   float64 `db:"-" json:"delivery_rate"`
+	MessageRate    float64 `db:"-" json:"message_rate"`
+	LaunchRate     float64 `db:"-" json:"launch_rate"`
+	ConversionRate float64 `db:"-" json:"conversion_rate"`
+}
+
+type MailingCampaignStats struct {
+	CampaignID int `db:"campaign_id" json:"campaign_id"`
+
+	Leased  int `db:"leased" json:"leased"`
+	Sent    int `db:"sent" json:"sent"`
+	Blocked int `db:"blocked" json:"blocked"`
+	Failed  int `db:"failed" json:"failed"`
+	Total   int `db:"total" json:"total"`
+
+	DeliveryRate float64 `db:"-" json:"delivery_rate"`
+}
+
+type MailingLease struct {
+	ID      int       `db:"id" json:"-"`
+	LeaseID uuid.UUID `db:"lease_id" json:"lease_id"`
+	BotID   int       `db:"bot_id" json:"bot_id"`
+
+	DepotChannelHash string `db:"depot_channel_hash" json:"depot_channel_hash"`
+	CampaignID       int    `db:"campaign_id" json:"campaign_id"`
+
+	State     string    `db:"state" json:"state"`
+	Users     int       `db:"users" json:"users"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+func (ml *MailingLease) Expired() bool {
+	return ml.State != MailingLeaseStateActive || time.Now().After(ml.ExpiresAt)
+}
+
+type MailingPolicy struct {
+	ID    int `db:"id" json:"-"`
+	BotID int `db:"bot_id" json:"bot_id"`
+
+	// zero means unlimited
+	MaxPerSecond int `db:"max_per_second" json:"max_per_second"`
+	MaxPerMinute int `db:"max_per_minute" json:"max_per_minute"`
+
+	// hours of the user local time, equal values disable quiet hours
+	QuietHoursStart int    `db:"quiet_hours_start" json:"quiet_hours_start"`
+	QuietHoursEnd   int    `db:"quiet_hours_end" json:"quiet_hours_end"`
+	DefaultTimezone string `db:"default_timezone" json:"default_timezone"`
+
+	// MinGap is the minimum number of seconds between two mailings to the same user
+	MinGap int `db:"min_gap" json:"min_gap"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// RateWindows returns the enabled rate limits of the policy.
+func (mp *MailingPolicy) RateWindows() []MailingRateWindow {
+	windows := make([]MailingRateWindow, 0, 2)
+
+	if mp.MaxPerSecond > 0 {
+		windows = append(windows, MailingRateWindow{Max: mp.MaxPerSecond, Seconds: 1})
+	}
+
+	if mp.MaxPerMinute > 0 {
+		windows = append(windows, MailingRateWindow{Max: mp.MaxPerMinute, Seconds: 60})
+	}
+
+	return windows
+}
+
+// IsQuietHour reports whether the hour is inside quiet hours, the window may wrap over midnight.
+func (mp *MailingPolicy) IsQuietHour(hour int) bool {
+	switch {
+	case mp.QuietHoursStart == mp.QuietHoursEnd:
+		return false
+	case mp.QuietHoursStart < mp.QuietHoursEnd:
+		return hour >= mp.QuietHoursStart && hour < mp.QuietHoursEnd
+	default:
+		return hour >= mp.QuietHoursStart || hour < mp.QuietHoursEnd
+	}
+}
+
+// MailingRateWindow caps the number of users the bot may lease within the last Seconds.
+type MailingRateWindow struct {
+	Max     int
+	Seconds int
+}
+
+// MailingRateLimitError is returned when the bot exhausted one of its rate limit windows.
+type MailingRateLimitError struct {
+	RetryAfter int
+}
+
+func (e *MailingRateLimitError) Error() string {
+	return "mailing rate limit exceeded"
+}
+
+// CapMailingLimit caps the batch size by the room left in every window,
+// leased returns how many users were leased within the last seconds.
+func CapMailingLimit(limit int, windows []MailingRateWindow, leased func(seconds int) (int, error)) (int, error) {
+	for _, window := range windows {
+		count, err := leased(window.Seconds)
+		if err != nil {
+			return 0, err
+		}
+
+		left := window.Max - count
+		if left <= 0 {
+			return 0, &MailingRateLimitError{RetryAfter: window.Seconds}
+		}
+
+		if left < limit {
+			limit = left
+		}
+	}
+
+	return limit, nil
+}
+
+const (
+	MailingDeliveryEventSent      = "sent"
+	MailingDeliveryEventFailed    = "failed"
+	MailingDeliveryEventBlocked   = "blocked"
+	MailingDeliveryEventUnblocked = "unblocked"
+
+	MailingErrorReasonBotBlocked      = "bot_blocked"
+	MailingErrorReasonChatNotFound    = "chat_not_found"
+	MailingErrorReasonUserDeactivated = "user_deactivated"
+	MailingErrorReasonFloodWait       = "flood_wait"
+	MailingErrorReasonTimeout         = "timeout"
+	MailingErrorReasonUnknown         = "unknown"
+)
+
+// mailingPermanentErrorReasons are failures which will not go away on retry,
+// users failing with them are blocked immediately instead of counting attempts.
+var mailingPermanentErrorReasons = map[string]struct{}{
+	MailingErrorReasonBotBlocked:      {},
+	MailingErrorReasonChatNotFound:    {},
+	MailingErrorReasonUserDeactivated: {},
+}
+
+const (
+	// MailingErrorReasonMaxLength is the size of users.mailing_error_reason and mailing_deliveries.reason
+	MailingErrorReasonMaxLength = 64
+	// MailingCampaignUserErrorMaxLength is the size of mailing_campaign_users.error
+	MailingCampaignUserErrorMaxLength = 255
+)
+
+// TruncateMailingError cuts sender errors to the column size, so long messages don't fail the state update.
+func TruncateMailingError(reason string, max int) string {
+	runes := []rune(reason)
+	if len(runes) <= max {
+		return reason
+	}
+
+	return string(runes[:max])
+}
+
+func IsPermanentMailingError(reason string) bool {
+	_, ok := mailingPermanentErrorReasons[reason]
+	return ok
+}
+
+type MailingDelivery struct {
+	ID         int `db:"id" json:"id"`
+	BotID      int `db:"bot_id" json:"bot_id"`
+	UserID     int `db:"user_id" json:"user_id"`
+	CampaignID int `db:"campaign_id" json:"campaign_id"`
+
+	Event     string `db:"event" json:"event"`
+	Reason    string `db:"reason" json:"reason"`
+	Permanent bool   `db:"permanent" json:"permanent"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type MailingBlocksRow struct {
+	Sent      int `db:"sent" json:"sent"`
+	Failed    int `db:"failed" json:"failed"`
+	Blocked   int `db:"blocked" json:"blocked"`
+	Unblocked int `db:"unblocked" json:"unblocked"`
+
+	BlockRate   float64 `db:"-" json:"block_rate"`
+	UnblockRate float64 `db:"-" json:"unblock_rate"`
+
+	ByPeriodDB time.Time `db:"by_period" json:"-"`
+	ByPeriod   string    `db:"-" json:"by_period"`
+}
@@ -0,0 +1,147 @@
+package types
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCapMailingLimit(t *testing.T) {
+	windows := []MailingRateWindow{
+		{Max: 100, Seconds: 60},
+		{Max: 1000, Seconds: 3600},
+	}
+
+	leased := map[int]int{
+		60:   70,
+		3600: 980,
+	}
+
+	limit, err := CapMailingLimit(50, windows, func(seconds int) (int, error) {
+		return leased[seconds], nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if limit != 20 {
+		t.Fatalf("limit = %d, want 20", limit)
+	}
+}
+
+func TestCapMailingLimitExhausted(t *testing.T) {
+	windows := []MailingRateWindow{
+		{Max: 100, Seconds: 60},
+		{Max: 1000, Seconds: 3600},
+	}
+
+	_, err := CapMailingLimit(50, windows, func(seconds int) (int, error) {
+		if seconds == 3600 {
+			return 1000, nil
+		}
+		return 0, nil
+	})
+
+	var rateErr *MailingRateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("error = %v, want MailingRateLimitError", err)
+	}
+
+	if rateErr.RetryAfter != 3600 {
+		t.Fatalf("retry after = %d, want 3600", rateErr.RetryAfter)
+	}
+}
+
+func TestTruncateMailingError(t *testing.T) {
+	for _, tc := range []struct {
+		reason string
+		max    int
+		want   string
+	}{
+		{reason: "timeout", max: 64, want: "timeout"},
+		{reason: "abcdef", max: 3, want: "abc"},
+		{reason: "ошибка", max: 3, want: "оши"},
+		{reason: "", max: 3, want: ""},
+	} {
+		if got := TruncateMailingError(tc.reason, tc.max); got != tc.want {
+			t.Errorf("TruncateMailingError(%q, %d) = %q, want %q", tc.reason, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestMailingLeaseExpired(t *testing.T) {
+	for name, tc := range map[string]struct {
+		lease   MailingLease
+		expired bool
+	}{
+		"active":   {lease: MailingLease{State: MailingLeaseStateActive, ExpiresAt: time.Now().Add(time.Minute)}},
+		"past ttl": {lease: MailingLease{State: MailingLeaseStateActive, ExpiresAt: time.Now().Add(-time.Second)}, expired: true},
+		"released": {lease: MailingLease{State: MailingLeaseStateReleased, ExpiresAt: time.Now().Add(time.Minute)}, expired: true},
+		"expired":  {lease: MailingLease{State: MailingLeaseStateExpired, ExpiresAt: time.Now().Add(time.Minute)}, expired: true},
+	} {
+		if got := tc.lease.Expired(); got != tc.expired {
+			t.Errorf("%s: Expired() = %v, want %v", name, got, tc.expired)
+		}
+	}
+}
+
+func TestPickMailingCampaignVariantDistribution(t *testing.T) {
+	variants := []*MailingCampaignVariant{
+		{ID: 1, Weight: 1},
+		{ID: 2, Weight: 3},
+	}
+
+	const users = 10000
+
+	picked := make(map[int]int)
+	for userID := 1; userID <= users; userID++ {
+		variant := PickMailingCampaignVariant(variants, 7, userID)
+		if variant == nil {
+			t.Fatalf("user %d got no variant", userID)
+		}
+
+		picked[variant.ID]++
+	}
+
+	// weights 1:3 give a quarter of the users to the first variant
+	if share := float64(picked[1]) / users; share < 0.22 || share > 0.28 {
+		t.Fatalf("first variant share = %.3f, want about 0.25", share)
+	}
+}
+
+func TestPickMailingCampaignVariantStable(t *testing.T) {
+	variants := []*MailingCampaignVariant{
+		{ID: 1, Weight: 1},
+		{ID: 2, Weight: 1},
+	}
+
+	// a user leased again, e.g. after the lease expired, keeps the variant of the campaign
+	for userID := 1; userID <= 100; userID++ {
+		first := PickMailingCampaignVariant(variants, 7, userID)
+		if again := PickMailingCampaignVariant(variants, 7, userID); again != first {
+			t.Fatalf("user %d got variant %d, then %d", userID, first.ID, again.ID)
+		}
+	}
+
+	// campaigns are split independently, so the same users don't always get the first variant
+	same := 0
+	for userID := 1; userID <= 100; userID++ {
+		if PickMailingCampaignVariant(variants, 7, userID) == PickMailingCampaignVariant(variants, 8, userID) {
+			same++
+		}
+	}
+
+	if same == 100 {
+		t.Fatal("every user got the same variant in both campaigns")
+	}
+}
+
+func TestPickMailingCampaignVariantWithoutWeights(t *testing.T) {
+	if variant := PickMailingCampaignVariant(nil, 7, 1); variant != nil {
+		t.Fatalf("got variant %d without variants", variant.ID)
+	}
+
+	if variant := PickMailingCampaignVariant([]*MailingCampaignVariant{{ID: 1}}, 7, 1); variant != nil {
+		t.Fatalf("got variant %d of zero weight", variant.ID)
+	}
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PersonTimelineEventJoined      = "joined"
+	PersonTimelineEventDeeplink    = "deeplink"
+	PersonTimelineEventTransaction = "transaction"
+)
+
+// Person is a telegram user across all bots, the first user row of the person is the unique one.
+type Person struct {
+	ID         int   `db:"id" json:"id"`
+	TelegramID int64 `db:"telegram_id" json:"telegram_id"`
+
+	FirstUserID int `db:"first_user_id" json:"first_user_id"`
+	FirstBotID  int `db:"first_bot_id" json:"first_bot_id"`
+	Bots        int `db:"bots" json:"bots"`
+
+	FirstSeenAt  time.Time `db:"first_seen_at" json:"first_seen_at"`
+	LastJoinedAt time.Time `db:"last_joined_at" json:"last_joined_at"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// PersonTimelineEntry is a single event of the person in one of the bots,
+// Details holds the deeplink label or the transaction blockchain.
+type PersonTimelineEntry struct {
+	At        time.Time `db:"at" json:"at"`
+	Event     string    `db:"event" json:"event"`
+	BotID     int       `db:"bot_id" json:"bot_id"`
+	UserID    int       `db:"user_id" json:"user_id"`
+	TraceUUID uuid.UUID `db:"trace_uuid" json:"trace_uuid"`
+	Details   string    `db:"details" json:"details"`
+}
@@ -0,0 +1,66 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// MailingSegmentFilter narrows down the audience of a mailing, empty fields are not applied.
+type MailingSegmentFilter struct {
+	LanguageCodes  []string `json:"language_codes,omitempty"`
+	CountryCodes   []string `json:"country_codes,omitempty"`
+	DeeplinkLabels []string `json:"deeplink_labels,omitempty"`
+
+	IsPremium  *bool `json:"is_premium,omitempty"`
+	Deposited  *bool `json:"deposited,omitempty"`
+	Subscribed *bool `json:"subscribed,omitempty"`
+
+	CreatedFrom  *time.Time `json:"created_from,omitempty"`
+	CreatedTo    *time.Time `json:"created_to,omitempty"`
+	MessagedFrom *time.Time `json:"messaged_from,omitempty"`
+	MessagedTo   *time.Time `json:"messaged_to,omitempty"`
+
+	SeenMin *int `json:"seen_min,omitempty"`
+	SeenMax *int `json:"seen_max,omitempty"`
+
+	// set from the bot mailing policy on every request and never stored,
+	// a non-nil empty AllowedCountryCodes matches no users
+	ExcludedCountryCodes []string   `json:"-"`
+	AllowedCountryCodes  []string   `json:"-"`
+	MailedBefore         *time.Time `json:"-"`
+}
+
+func (f MailingSegmentFilter) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func (f *MailingSegmentFilter) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case nil:
+		return nil
+	}
+
+	return errors.New("unsupported mailing segment filter type")
+}
+
+type MailingSegment struct {
+	ID    int `db:"id" json:"id"`
+	BotID int `db:"bot_id" json:"bot_id"`
+
+	Name   string               `db:"name" json:"name"`
+	Filter MailingSegmentFilter `db:"filter" json:"filter"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"time"
+	_ "time/tzdata"
+)
+
+// CountryTimezones maps ISO country codes to the timezone of the most populated region of the country.
+var CountryTimezones = map[string]string{
+	"AE": "Asia/Dubai",
+	"AM": "Asia/Yerevan",
+	"AR": "America/Argentina/Buenos_Aires",
+	"AT": "Europe/Vienna",
+	"AU": "Australia/Sydney",
+	"AZ": "Asia/Baku",
+	"BD": "Asia/Dhaka",
+	"BE": "Europe/Brussels",
+	"BG": "Europe/Sofia",
+	"BR": "America/Sao_Paulo",
+	"BY": "Europe/Minsk",
+	"CA": "America/Toronto",
+	"CH": "Europe/Zurich",
+	"CL": "America/Santiago",
+	"CN": "Asia/Shanghai",
+	"CO": "America/Bogota",
+	"CY": "Asia/Nicosia",
+	"CZ": "Europe/Prague",
+	"DE": "Europe/Berlin",
+	"DK": "Europe/Copenhagen",
+	"EE": "Europe/Tallinn",
+	"EG": "Africa/Cairo",
+	"ES": "Europe/Madrid",
+	"FI": "Europe/Helsinki",
+	"FR": "Europe/Paris",
+	"GB": "Europe/London",
+	"GE": "Asia/Tbilisi",
+	"GR": "Europe/Athens",
+	"HK": "Asia/Hong_Kong",
+	"HU": "Europe/Budapest",
+	"ID": "Asia/Jakarta",
+	"IE": "Europe/Dublin",
+	"IL": "Asia/Jerusalem",
+	"IN": "Asia/Kolkata",
+	"IR": "Asia/Tehran",
+	"IT": "Europe/Rome",
+	"JP": "Asia/Tokyo",
+	"KG": "Asia/Bishkek",
+	"KR": "Asia/Seoul",
+	"KZ": "Asia/Almaty",
+	"LT": "Europe/Vilnius",
+	"LV": "Europe/Riga",
+	"MD": "Europe/Chisinau",
+	"MX": "America/Mexico_City",
+	"MY": "Asia/Kuala_Lumpur",
+	"NG": "Africa/Lagos",
+	"NL": "Europe/Amsterdam",
+	"NO": "Europe/Oslo",
+	"PH": "Asia/Manila",
+	"PK": "Asia/Karachi",
+	"PL": "Europe/Warsaw",
+	"PT": "Europe/Lisbon",
+	"RO": "Europe/Bucharest",
+	"RS": "Europe/Belgrade",
+	"RU": "Europe/Moscow",
+	"SA": "Asia/Riyadh",
+	"SE": "Europe/Stockholm",
+	"SG": "Asia/Singapore",
+	"SK": "Europe/Bratislava",
+	"TH": "Asia/Bangkok",
+	"TJ": "Asia/Dushanbe",
+	"TM": "Asia/Ashgabat",
+	"TR": "Europe/Istanbul",
+	"UA": "Europe/Kyiv",
+	"US": "America/New_York",
+	"UZ": "Asia/Tashkent",
+	"VN": "Asia/Ho_Chi_Minh",
+	"ZA": "Africa/Johannesburg",
+}
+
+// LocalHour returns the hour of t in the given timezone, falling back to UTC for unknown timezones.
+func LocalHour(t time.Time, timezone string) int {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return t.UTC().Hour()
+	}
+
+	return t.In(loc).Hour()
+}
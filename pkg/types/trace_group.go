@@ -0,0 +1,115 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// TraceGroupBindingPolicyNone keeps the depot channel of the bot for new users
+	TraceGroupBindingPolicyNone = "none"
+	// TraceGroupBindingPolicyOldestUser moves new users to the channel of their oldest user in the group
+	TraceGroupBindingPolicyOldestUser = "oldest_user"
+	// TraceGroupBindingPolicyDefaultChannel moves new users to the default channel of the group
+	TraceGroupBindingPolicyDefaultChannel = "default_channel"
+)
+
+var TraceGroupBindingPolicies = map[string]struct{}{
+	TraceGroupBindingPolicyNone:           {},
+	TraceGroupBindingPolicyOldestUser:     {},
+	TraceGroupBindingPolicyDefaultChannel: {},
+}
+
+// TraceGroup is a named group of bots sharing the trace uuid, the binding policy applies
+// to the member bots with binding enabled.
+type TraceGroup struct {
+	ID        int       `db:"id" json:"id"`
+	TraceUUID uuid.UUID `db:"trace_uuid" json:"trace_uuid"`
+	Name      string    `db:"name" json:"name"`
+
+	DepotChannelHash   string `db:"depot_channel_hash" json:"depot_channel_hash"`
+	TelegramChannelID  int64  `db:"telegram_channel_id" json:"telegram_channel_id"`
+	TelegramChannelURL string `db:"telegram_channel_url" json:"telegram_channel_url"`
+
+	BindingPolicy string `db:"binding_policy" json:"binding_policy"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// TraceGroupBotStats are the users of the member bot, UniqueUsers counts the users
+// which are the first user of their telegram id in the whole group.
+type TraceGroupBotStats struct {
+	BotID       int `json:"bot_id"`
+	Users       int `json:"users"`
+	UniqueUsers int `json:"unique_users"`
+	Deposited   int `json:"deposited"`
+}
+
+// TraceGroupStats are the users of the group deduplicated by telegram id.
+type TraceGroupStats struct {
+	Users       int `json:"users"`
+	UniqueUsers int `json:"unique_users"`
+	Deposited   int `json:"deposited"`
+
+	Bots []*TraceGroupBotStats `json:"bots"`
+}
+
+// TraceGroupUser is a user of a member bot joined within the stats range.
+type TraceGroupUser struct {
+	BotID      int   `db:"bot_id"`
+	TelegramID int64 `db:"telegram_id"`
+	Deposited  bool  `db:"deposited"`
+
+	// First is set when the user is the first user of the telegram id in the whole group
+	First bool `db:"first"`
+}
+
+// NewTraceGroupStats counts the users of the member bots. A telegram id joining several bots
+// is counted by every bot but once for the group, only its first user in the group is unique.
+func NewTraceGroupStats(botIDs []int, users []*TraceGroupUser) *TraceGroupStats {
+	res := &TraceGroupStats{
+		Bots: make([]*TraceGroupBotStats, 0, len(botIDs)),
+	}
+
+	bots := make(map[int]*TraceGroupBotStats, len(botIDs))
+	botDeposited := make(map[int]map[int64]struct{}, len(botIDs))
+	for _, id := range botIDs {
+		bots[id] = &TraceGroupBotStats{BotID: id}
+		botDeposited[id] = make(map[int64]struct{})
+		res.Bots = append(res.Bots, bots[id])
+	}
+
+	telegramIDs := make(map[int64]struct{})
+	deposited := make(map[int64]struct{})
+
+	for _, user := range users {
+		bot, ok := bots[user.BotID]
+		if !ok {
+			continue
+		}
+
+		bot.Users++
+		telegramIDs[user.TelegramID] = struct{}{}
+
+		if user.First {
+			bot.UniqueUsers++
+			res.UniqueUsers++
+		}
+
+		if user.Deposited {
+			botDeposited[user.BotID][user.TelegramID] = struct{}{}
+			deposited[user.TelegramID] = struct{}{}
+		}
+	}
+
+	for id, bot := range bots {
+		bot.Deposited = len(botDeposited[id])
+	}
+
+	res.Users = len(telegramIDs)
+	res.Deposited = len(deposited)
+
+	return res
+}
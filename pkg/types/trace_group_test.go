@@ -0,0 +1,63 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewTraceGroupStatsDedupesTelegramIDs(t *testing.T) {
+	users := []*TraceGroupUser{
+		// telegram id 1 joined bot 1 first, then bot 2
+		{BotID: 1, TelegramID: 1, First: true},
+		{BotID: 2, TelegramID: 1, Deposited: true},
+		// telegram id 2 only joined bot 2
+		{BotID: 2, TelegramID: 2, First: true, Deposited: true},
+		// telegram id 3 joined bot 1 before the range, only the later user is in range
+		{BotID: 2, TelegramID: 3},
+	}
+
+	stats := NewTraceGroupStats([]int{1, 2, 3}, users)
+
+	want := &TraceGroupStats{
+		Users:       3,
+		UniqueUsers: 2,
+		Deposited:   2,
+		Bots: []*TraceGroupBotStats{
+			{BotID: 1, Users: 1, UniqueUsers: 1},
+			{BotID: 2, Users: 3, UniqueUsers: 1, Deposited: 2},
+			{BotID: 3},
+		},
+	}
+
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+func TestNewTraceGroupStatsCountsDepositedTelegramIDOnce(t *testing.T) {
+	users := []*TraceGroupUser{
+		{BotID: 1, TelegramID: 1, First: true, Deposited: true},
+		{BotID: 2, TelegramID: 1, Deposited: true},
+	}
+
+	stats := NewTraceGroupStats([]int{1, 2}, users)
+
+	if stats.Deposited != 1 || stats.Bots[0].Deposited != 1 || stats.Bots[1].Deposited != 1 {
+		t.Fatalf("deposited = %d, by bots %d and %d, want 1 for the group and each bot",
+			stats.Deposited, stats.Bots[0].Deposited, stats.Bots[1].Deposited)
+	}
+}
+
+func TestNewTraceGroupStatsSkipsNonMembers(t *testing.T) {
+	users := []*TraceGroupUser{
+		{BotID: 1, TelegramID: 1, First: true},
+		// a user of a bot deleted meanwhile
+		{BotID: 9, TelegramID: 2, First: true},
+	}
+
+	stats := NewTraceGroupStats([]int{1}, users)
+
+	if stats.Users != 1 || stats.UniqueUsers != 1 || len(stats.Bots) != 1 {
+		t.Fatalf("stats = %+v, want only the member bot users", stats)
+	}
+}
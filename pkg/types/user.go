@@ -59,6 +59,12 @@ type User struct {
 	MailingState          string    `db:"mailing_state" json:"mailing_state"`
 	MailingStateUpdatedAt time.Time `db:"mailing_state_updated_at" json:"mailing_state_updated_at"`
 	MailingFailedAttempts int       `db:"mailing_failed_attempts" json:"mailing_failed_attempts"`
+	MailingLeaseID        uuid.UUID `db:"mailing_lease_id" json:"mailing_lease_id"`
+	MailedAt              time.Time `db:"mailed_at" json:"mailed_at"`
+	MailingErrorReason    string    `db:"mailing_error_reason" json:"mailing_error_reason"`
+
+	// ErasedAt is set once the personal fields are anonymised, the telegram_id is replaced by a pseudonym
+	ErasedAt time.Time `db:"erased_at" json:"erased_at"`
 
 	MessagedAt time.Time `db:"messaged_at" json:"messaged_at"`
 	CreatedAt  time.Time `db:"created_at" json:"created_at"`
@@ -79,3 +85,22 @@ func (u *User) GenerateForwardSenderName() string {
 
 	return res
 }
+
+// UsersSearchFilter matches users by name, username or forward sender name prefix or trigram similarity.
+type UsersSearchFilter struct {
+	Query string
+
+	BotID       int
+	Deposited   *bool
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	Limit  int
+	Cursor *UsersSearchCursor
+}
+
+// UsersSearchCursor points to the last user of the previous page, pages are ordered by score and id.
+type UsersSearchCursor struct {
+	Score float64
+	ID    int
+}